@@ -0,0 +1,82 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MapoMagpie/rimedm/dict"
+)
+
+// 将变更记录写入path，以.json结尾时输出JSON，否则输出可被apply命令应用的格式
+func writeChangelog(path string, items []dict.ChangelogItem) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = dict.WriteChangelog(file, items, strings.EqualFold(filepath.Ext(path), ".json"))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("写入变更记录失败: %w", err)
+	}
+	return nil
+}
+
+// 应用变更文件，任意一行失败时不写入任何文件；写入部分文件失败时返回的错误中列出已写入的文件
+func runApply(w io.Writer, opts *Options, dc *dict.Dictionary) error {
+	if len(opts.Args) != 1 {
+		return errors.New("用法: rimedm apply 变更文件")
+	}
+	file, err := os.Open(opts.Args[0])
+	if err != nil {
+		return err
+	}
+	ops, err := dict.ParsePatch(file)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", opts.Args[0], err)
+	}
+	if _, err := dc.ApplyPatch(ops, opts.UserPath); err != nil {
+		return fmt.Errorf("%s: %w，未写入任何修改", opts.Args[0], err)
+	}
+	changes, err := flushWithHooks(opts, dc)
+	if err != nil {
+		// 各文件独立写入，列出已写入的文件
+		written := make([]string, 0)
+		for _, c := range changes {
+			if !slices.Contains(written, c.FilePath) {
+				written = append(written, c.FilePath)
+			}
+		}
+		if len(written) > 0 {
+			return fmt.Errorf("%w\n以下文件已写入: %s", err, strings.Join(written, ", "))
+		}
+		return fmt.Errorf("%w，未写入任何修改", err)
+	}
+	if len(changes) > 0 && opts.GitHistory {
+		if err := gitCommit(gitRepoPath(opts), changes); err != nil {
+			fmt.Fprintf(os.Stderr, "git提交失败: %v\n", err)
+		}
+	}
+	counts := make(map[dict.ChangeType]int)
+	for _, c := range changes {
+		counts[c.Type]++
+	}
+	fmt.Fprintf(w, "已应用 %d 行，新增 %d 项，修改 %d 项，删除 %d 项\n",
+		len(ops), counts[dict.CHANGE_ADD], counts[dict.CHANGE_MOD], counts[dict.CHANGE_DEL])
+	if len(changes) > 0 {
+		rimeDeployer.SetCommand(opts.RestartRimeCmd)
+		rimeDeployer.SetPostDeploy(opts.Hooks.PostDeploy, opts.ConfigPath)
+		rimeDeployer.Deploy(changes...)
+		rimeDeployer.Wait()
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/MapoMagpie/rimedm/dict"
+	"github.com/goccy/go-yaml"
+)
+
+// 运行 config check|init 子命令
+func runConfig(w io.Writer, opts *Options) error {
+	if len(opts.Args) != 1 {
+		return errors.New("用法: rimedm config check|init [--force]")
+	}
+	switch opts.Args[0] {
+	case "check":
+		return checkConfig(w, opts.ConfigPath, true)
+	case "init":
+		if _, err := os.Stat(opts.ConfigPath); err == nil {
+			if !opts.Force {
+				return fmt.Errorf("配置文件已存在: %s，使用 --force 覆盖", opts.ConfigPath)
+			}
+			// 保留原配置文件以便找回其中的配置
+			if err := os.Rename(opts.ConfigPath, opts.ConfigPath+".bak"); err != nil {
+				return fmt.Errorf("备份配置文件失败: %w", err)
+			}
+			fmt.Fprintf(w, "原配置文件已备份为: %s.bak\n", opts.ConfigPath)
+		}
+		if err := initConfigFile(opts.ConfigPath); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "已生成配置文件: %s\n", opts.ConfigPath)
+		return nil
+	}
+	return fmt.Errorf("未知的config命令: %s，可用的命令: check, init", opts.Args[0])
+}
+
+// 检查配置文件：未知的配置项、不存在的词典、不在词典中的用户词典、部署命令，
+// 有profiles时逐个检查。testDeploy时执行当前使用的配置的部署命令，其他的只检查命令是否存在
+func checkConfig(w io.Writer, path string, testDeploy bool) error {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(bs, &raw); err != nil {
+		return fmt.Errorf("解析配置文件[%s]失败: %w", path, err)
+	}
+	issues := make([]string, 0)
+	report := func(format string, args ...any) {
+		issues = append(issues, fmt.Sprintf(format, args...))
+	}
+
+	keys, hookKeys := configKeys(reflect.TypeFor[Options]()), configKeys(reflect.TypeFor[Hooks]())
+	checkKeys := func(prefix string, m map[string]any, inProfile bool) {
+		for _, key := range slices.Sorted(maps.Keys(m)) {
+			if inProfile && (key == "profiles" || key == "profile") {
+				report("%s配置项 %s 不能在profile中使用", prefix, key)
+			} else if !slices.Contains(keys, key) {
+				report("%s未知的配置项: %s%s", prefix, key, suggestKey(key, keys))
+			}
+		}
+		if hooks, ok := m["hooks"].(map[string]any); ok {
+			for _, key := range slices.Sorted(maps.Keys(hooks)) {
+				if !slices.Contains(hookKeys, key) {
+					report("%s未知的钩子: %s%s", prefix, key, suggestKey(key, hookKeys))
+				}
+			}
+		}
+	}
+	checkKeys("", raw, false)
+	if profiles, ok := raw["profiles"].(map[string]any); ok {
+		for _, name := range slices.Sorted(maps.Keys(profiles)) {
+			if m, ok := profiles[name].(map[string]any); ok {
+				checkKeys(fmt.Sprintf("profile %s: ", name), m, true)
+			} else {
+				report("profile %s: 应为配置项的映射", name)
+			}
+		}
+	}
+
+	base, err := parseFromFile(path)
+	if err != nil {
+		return err
+	}
+	// 设置了profile时，不单独检查profile以外的配置
+	targets := profileNames(&base)
+	if base.Profile == "" {
+		targets = append([]string{""}, targets...)
+	}
+	for _, name := range targets {
+		opts, prefix := base, ""
+		if name != "" {
+			prefix = fmt.Sprintf("profile %s: ", name)
+			if opts, err = applyProfile(base, name); err != nil {
+				report("%s%v", prefix, err)
+				continue
+			}
+		}
+		opts.ConfigPath = path
+		if err := opts.normalize(); err != nil {
+			report("%s%v", prefix, err)
+			continue
+		}
+		for _, issue := range checkOptions(&opts, testDeploy && name == base.Profile) {
+			report("%s%s", prefix, issue)
+		}
+	}
+
+	for _, issue := range issues {
+		if _, err := fmt.Fprintln(w, issue); err != nil {
+			return err
+		}
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("发现 %d 个问题", len(issues))
+	}
+	fmt.Fprintf(w, "配置文件没有问题: %s\n", path)
+	return nil
+}
+
+// 检查已修正路径的配置，runDeploy时执行部署命令
+func checkOptions(opts *Options, runDeploy bool) []string {
+	issues := make([]string, 0)
+	paths := make([]string, 0, len(opts.DictPaths))
+	for _, p := range opts.DictPaths {
+		if _, err := os.Stat(p); err != nil {
+			issues = append(issues, fmt.Sprintf("词典文件不存在: %s", p))
+			continue
+		}
+		paths = append(paths, p)
+	}
+	if len(paths) > 0 {
+		fes, err := dict.LoadItems(paths...)
+		if err != nil {
+			issues = append(issues, fmt.Sprintf("加载词典失败: %v", err))
+		} else {
+			if opts.UserPath != "" && !slices.ContainsFunc(fes, func(fe *dict.FileEntries) bool {
+				return filepath.Clean(fe.FilePath) == filepath.Clean(opts.UserPath)
+			}) {
+				issues = append(issues, fmt.Sprintf("user_path不在已加载的词典中(需被主词典的import_tables引用): %s", opts.UserPath))
+			}
+			if err := dict.SetReadonly(fes, opts.ReadonlyPaths); err != nil {
+				issues = append(issues, err.Error())
+			}
+		}
+	}
+	if opts.FrequencyPath != "" {
+		if _, err := os.Stat(opts.FrequencyPath); err != nil {
+			issues = append(issues, fmt.Sprintf("词频表不存在: %s", opts.FrequencyPath))
+		}
+	}
+	if opts.RestartRimeCmd != "" {
+		if runDeploy {
+			if err := runDeployCmd(opts.RestartRimeCmd); err != nil {
+				issues = append(issues, fmt.Sprintf("部署命令执行失败: %v", err))
+			}
+		} else if _, err := exec.LookPath(commandName(opts.RestartRimeCmd)); err != nil {
+			issues = append(issues, fmt.Sprintf("找不到部署命令: %s", commandName(opts.RestartRimeCmd)))
+		}
+	}
+	return issues
+}
+
+// 配置文件中可用的配置项，即结构体t的yaml标签
+func configKeys(t reflect.Type) []string {
+	keys := make([]string, 0)
+	for i := range t.NumField() {
+		if tag := t.Field(i).Tag.Get("yaml"); tag != "" && tag != "-" {
+			keys = append(keys, strings.Split(tag, ",")[0])
+		}
+	}
+	return keys
+}
+
+// 与key相近的配置项，用于提示拼写错误
+func suggestKey(key string, keys []string) string {
+	best, bestDist := "", 3
+	for _, k := range keys {
+		if d := editDistance(key, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return "，是否为 " + best + "?"
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// 命令中的程序名，可能被引号包围
+func commandName(cmd string) string {
+	cmd = strings.TrimSpace(cmd)
+	if rest, ok := strings.CutPrefix(cmd, "\""); ok {
+		name, _, _ := strings.Cut(rest, "\"")
+		return name
+	}
+	if fields := strings.Fields(cmd); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_checkConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.dict.yaml":      "---\nname: main\nimport_tables:\n  - main_user\n...\n你好\tnau\n",
+		"main_user.dict.yaml": "---\nname: main_user\n...\n",
+		"other.dict.yaml":     "---\nname: other\n...\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(config string) string {
+		path := filepath.Join(dir, "config.yaml")
+		if err := os.WriteFile(path, []byte(strings.ReplaceAll(config, "DIR", dir)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	out := strings.Builder{}
+	path := write("dict_paths:\n  - DIR/main.dict.yaml\nuser_path: DIR/main_user.dict.yaml\nrestart_rime_cmd: true\n")
+	if err := checkConfig(&out, path, true); err != nil {
+		t.Errorf("checkConfig() error = %v, output %q", err, out.String())
+	}
+
+	out.Reset()
+	path = write(`dict_path:
+  - DIR/main.dict.yaml
+dict_paths:
+  - DIR/main.dict.yaml
+  - DIR/missing.dict.yaml
+user_path: DIR/other.dict.yaml
+sync_on_chang: false
+hooks:
+  post_flsh: echo
+restart_rime_cmd: "\"DIR/no-such-deployer\" --reload"
+profiles:
+  ok:
+    dict_paths:
+      - DIR/other.dict.yaml
+    restart_rime_cmd: ""
+  bad:
+    weight_flor: 1
+    restart_rime_cmd: no-such-deployer
+`)
+	err := checkConfig(&out, path, false)
+	if err == nil || err.Error() != "发现 10 个问题" {
+		t.Errorf("checkConfig() error = %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"未知的配置项: dict_path，是否为 dict_paths?",
+		"未知的配置项: sync_on_chang，是否为 sync_on_change?",
+		"未知的钩子: post_flsh，是否为 post_flush?",
+		"profile bad: 未知的配置项: weight_flor，是否为 weight_floor?",
+		"词典文件不存在: " + filepath.Join(dir, "missing.dict.yaml"),
+		"user_path不在已加载的词典中",
+		"找不到部署命令: " + filepath.Join(dir, "no-such-deployer"),
+		"profile bad: 词典文件不存在",
+		"profile bad: user_path不在已加载的词典中",
+		"profile bad: 找不到部署命令: no-such-deployer",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("checkConfig() output missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "profile ok:") {
+		t.Errorf("checkConfig() profile ok should have no issue:\n%s", got)
+	}
+}
+
+func Test_runConfig_init(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("dict_paths: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Builder{}
+	opts := &Options{Command: "config", Args: []string{"init"}, ConfigPath: path}
+	if err := runConfig(&out, opts); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("runConfig(init) without --force error = %v", err)
+	}
+	opts.Force = true
+	if err := runConfig(&out, opts); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := os.ReadFile(path + ".bak"); string(bs) != "dict_paths: []\n" {
+		t.Errorf("backup = %q", bs)
+	}
+	if bs, _ := os.ReadFile(path); !strings.Contains(string(bs), "# Rime Dict Manager config file") {
+		t.Errorf("config = %q", bs)
+	}
+}
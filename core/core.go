@@ -2,13 +2,18 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"maps"
 	"math"
 	"os"
+	"path/filepath"
 	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/MapoMagpie/rimedm/dict"
@@ -18,20 +23,74 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-func Start(opts *Options) {
+// Start 运行子命令或Tui，返回的错误应输出到终端并以非零状态码退出
+func Start(opts *Options) error {
+	switch opts.Command {
+	case "diff", "merge":
+		return runFileCommand(opts)
+	case "config":
+		return runConfig(os.Stdout, opts)
+	}
+	// 在Tui中切换profile后，重新加载词典并再次运行Tui
+	var changelog []dict.ChangelogItem
+	for {
+		next, dc, err := runProfile(opts, changelog)
+		if dc != nil {
+			changelog = append(changelog, dc.Changelog()...)
+		}
+		if next == nil || err != nil {
+			if opts.Changelog != "" && (dc != nil || changelog != nil) {
+				err = errors.Join(err, writeChangelog(opts.Changelog, changelog))
+			}
+			return err
+		}
+		opts = next
+	}
+}
+
+// 加载词典并运行子命令或Tui，changelog为之前的profile中的变更记录。
+// 返回的dc用于收集此次的变更记录，在Tui中切换profile时返回新的配置
+func runProfile(opts *Options, changelog []dict.ChangelogItem) (next *Options, dc *dict.Dictionary, err error) {
 	// load dict file and create dictionary
 	start := time.Now()
-	fes := dict.LoadItems(opts.DictPaths...)
+	mutil.IDGen.Reset() // 文件ID为uint8，每次加载时重新分配，避免多次切换profile后溢出
+	fes, err := dict.LoadItems(opts.DictPaths...)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, fe := range fes {
+		for _, w := range fe.Warnings {
+			printWarning(os.Stderr, w)
+		}
+	}
 	sort.Slice(fes, func(i, j int) bool {
 		return fes[j].Cmp(fes[i])
 	})
+	if err := dict.SetReadonly(fes, opts.ReadonlyPaths); err != nil {
+		return nil, nil, err
+	}
 	since := time.Since(start)
-	log.Printf("Load %s: %s\n", opts.DictPaths, since)
-	dc := dict.NewDictionary(fes, &dict.CacheMatcher{})
+	slog.Info("load dictionary", "paths", opts.DictPaths, "files", len(fes), "elapsed", since)
+	dc = dict.NewDictionary(fes, &dict.CacheMatcher{})
 	if opts.Export != "" {
 		columns := parseColumnsFromArgments(opts.ExportColumns)
-		dc.ExportDict(opts.Export, columns, opts.ExportWithSort)
-		return
+		return nil, nil, dc.ExportDict(opts.Export, columns, opts.ExportWithSort)
+	}
+	switch opts.Command {
+	case "stats":
+		if err := printStats(os.Stdout, dc.Stats(), opts.JSON); err != nil {
+			return nil, nil, fmt.Errorf("输出统计数据失败: %w", err)
+		}
+		return nil, nil, nil
+	case "lint":
+		return nil, nil, printLint(os.Stdout, os.Stderr, dc)
+	case "apply":
+		if err := runApply(os.Stdout, opts, dc); err != nil {
+			return nil, nil, err
+		}
+		return nil, dc, nil
+	case "fmt":
+		return nil, nil, runFormat(os.Stdout, opts, dc, fes)
 	}
 
 	// collect file name, will show on addition
@@ -47,6 +106,63 @@ func Start(opts *Options) {
 	searchChan := make(chan string, 20)
 	listManager := tui.NewListManager(searchChan)
 	listManager.SetFiles(fileNames)
+	// 显示在列表区域的面板，各自持有项、选择的位置与菜单
+	previewPanel := listManager.AddPanel().SelectsItem() // 当前项的编码在Rime中的候选顺序
+	weightPanel := listManager.AddPanel()                // 权重工具
+	unmatchedPanel := listManager.AddPanel()             // 导入词频时未匹配的字词
+	statsPanel := listManager.AddPanel()                 // 词典的统计数据
+	historyPanel := listManager.AddPanel()               // 当前项的变更历史
+	profilePanel := listManager.AddPanel()               // 配置文件中的profile
+
+	// 导入词频时，词频表中未匹配到任何项的字词
+	var unmatchedWords []dict.Unmatched
+	// 是否正在选择要将未匹配的字词添加到哪个文件
+	addingUnmatched := false
+
+	// 等待确认的操作
+	var pendingConfirm func(m *tui.Model) tea.Cmd
+	menuNameConfirmYes := tui.Menu{Name: "Y确认", Cb: func(m *tui.Model) tea.Cmd {
+		fn := pendingConfirm
+		pendingConfirm = nil
+		if fn == nil {
+			return tui.ExitMenuCmd
+		}
+		return fn(m)
+	}}
+	menuNameConfirmNo := tui.Menu{Name: "N取消", Cb: func(m *tui.Model) tea.Cmd {
+		pendingConfirm = nil
+		return tea.Batch(tui.ExitMenuCmd, notify("已取消"))
+	}}
+	confirmMenus := []*tui.Menu{&menuNameConfirmNo, &menuNameConfirmYes} // 默认选中取消
+	// 需要确认时显示确认菜单，确认后执行fn，否则直接执行fn
+	askConfirm := func(m *tui.Model, action string, fn func(m *tui.Model) tea.Cmd) tea.Cmd {
+		if !opts.Confirm {
+			return fn(m)
+		}
+		pendingConfirm = fn
+		m.MenuIndex = 0
+		m.ShowMenus()
+		return notify("确认%s？", action)
+	}
+
+	// 只读文件中的项无法修改，将修改后的内容添加到用户词典中，使其优先于原有的项
+	redirectToUser := func(data dict.Data) tea.Cmd {
+		i := slices.IndexFunc(fes, func(fe *dict.FileEntries) bool {
+			return opts.UserPath != "" && filepath.Clean(fe.FilePath) == filepath.Clean(opts.UserPath)
+		})
+		if i == -1 || fes[i].Readonly {
+			return notify("只读文件中的项不能修改，可配置用户词典(user_path)以保存修改后的项")
+		}
+		user := fes[i]
+		data.Rest = "" // 超出列声明的字段属于原文件
+		data.ResetColumns(&user.Columns)
+		raw := data.ToString()
+		if err := dc.Add(dict.NewEntryAdd(raw, user.ID, data)); err != nil {
+			return notify("添加到用户词典失败: %v", err)
+		}
+		slog.Debug("redirect readonly modify to user dict", "raw", raw)
+		return notify("只读文件中的项不能修改，已将修改后的项添加到用户词典 %s", filepath.Base(user.FilePath))
+	}
 
 	// 添加菜单
 	menuNameAdd := tui.Menu{Name: "A添加",
@@ -55,19 +171,21 @@ func Start(opts *Options) {
 				return tui.ExitMenuCmd
 			}
 			file, err := m.CurrFile()
-			fe := file.(*dict.FileEntries)
 			if err != nil {
-				panic(fmt.Sprintf("add to dict error: %v", err))
+				return notify("添加失败: %v", err)
 			}
+			fe := file.(*dict.FileEntries)
 			raw := strings.TrimSpace(strings.Join(m.Inputs, ""))
 			if raw == "" {
 				return
 			}
+			raw, extra := dict.ParseExtraInput(raw, fe.Columns)
 			pair, cols := dict.ParseInput(raw, slices.Index(fe.Columns, dict.COLUMN_STEM) != -1)
 			if len(pair) == 0 { // allow add single column
 				return tui.ExitMenuCmd
 			}
 			data, _ := dict.ParseData(pair, &cols)
+			data.Extra = extra
 			data.ResetColumns(&fe.Columns)
 			curr, err := listManager.Curr()
 			if err == nil { // 自动修改权重
@@ -77,17 +195,25 @@ func Start(opts *Options) {
 					data.Weight = currEntryData.Weight + 1
 				}
 			}
+			blocked, warning := checkCode(opts, fe, data.Code)
+			if blocked { // 保留输入以便修改
+				return tea.Batch(tui.ExitMenuCmd, warning)
+			}
 			entryRaw := data.ToString()
-			dc.Add(dict.NewEntryAdd(entryRaw, fe.ID, data))
-			log.Printf("add item: %s\n", entryRaw)
+			if err := dc.Add(dict.NewEntryAdd(entryRaw, fe.ID, data)); err != nil {
+				return tea.Batch(tui.ExitMenuCmd, notify("添加到 %s 失败: %v", filepath.Base(fe.FilePath), err))
+			}
+			slog.Debug("add item", "raw", entryRaw)
 			m.Inputs = strings.Split(data.Code, "")
 			m.InputCursor = len(m.Inputs)
 			dc.ResetMatcher()
 			FlushAndSync(opts, dc, opts.SyncOnChange)
-			return tui.ExitMenuCmd
+			added := dict.Change{Type: dict.CHANGE_ADD, FilePath: fe.FilePath, Raw: entryRaw}
+			return tea.Batch(tui.ExitMenuCmd, warning, onAddHook(opts, added))
 		},
 		OnSelected: func(m *tui.Model) {
 			m.ListManager.ListMode = tui.LIST_MODE_FILE
+			addingUnmatched = false
 		},
 	}
 
@@ -103,10 +229,18 @@ func Start(opts *Options) {
 			}
 			switch item := item.(type) {
 			case *dict.MatchResult:
-				dc.Delete(item.Entry)
-				log.Printf("delete item: %s\n", item)
-				dc.ResetMatcher()
-				FlushAndSync(opts, dc, opts.SyncOnChange)
+				if fe := fileOf(fes, item.Entry); fe != nil && fe.Readonly { // 码表无法表示删除其他文件中的项，因此不添加到用户词典
+					return tea.Batch(tui.ExitMenuCmd, notify("只读文件中的项不能删除，删除不会转到用户词典，可将 %s 移出只读文件(readonly_paths)后删除", filepath.Base(fe.FilePath)))
+				}
+				return askConfirm(m, fmt.Sprintf("删除 [%s]", item.Entry.Raw()), func(m *tui.Model) tea.Cmd {
+					if err := dc.Delete(item.Entry); err != nil {
+						return tea.Batch(tui.ExitMenuCmd, notify("删除失败: %v", err))
+					}
+					slog.Debug("delete item", "item", item)
+					dc.ResetMatcher()
+					FlushAndSync(opts, dc, opts.SyncOnChange)
+					return tui.ExitMenuCmd
+				})
 			}
 			return tui.ExitMenuCmd
 		},
@@ -125,19 +259,21 @@ func Start(opts *Options) {
 				m.InputCursor = 0
 				return tui.ExitMenuCmd
 			}
+			mr, ok := item.(*dict.MatchResult)
+			if !ok {
+				return tui.ExitMenuCmd
+			}
+			fe := fileOf(fes, mr.Entry)
+			if fe == nil {
+				return notify("修改失败: 此项不属于任何已加载的文件")
+			}
 			m.Modifying = true
 			modifyingItem = item
-			m.Inputs = make([]string, 0)
-			split := strings.SplitSeq(strings.TrimSpace(modifyingItem.String()), "")
-			for sp := range split {
-				if sp == "	" {
-					m.Inputs = append(m.Inputs, " ")
-				} else {
-					m.Inputs = append(m.Inputs, sp)
-				}
-			}
-			m.InputCursor = len(m.Inputs)
+			m.Form = entryForm(opts, fe, mr.Entry)
 			m.MenuIndex = 0
+			if fe.Readonly {
+				return tea.Batch(tui.ExitMenuCmd, notify("%s 是只读文件，修改后的项将添加到用户词典", filepath.Base(fe.FilePath)))
+			}
 			return tui.ExitMenuCmd
 		},
 		OnSelected: func(m *tui.Model) {
@@ -147,34 +283,38 @@ func Start(opts *Options) {
 
 	// 确认修改菜单
 	menuNameConfirm := tui.Menu{Name: "C确认", Cb: func(m *tui.Model) tea.Cmd {
-		m.Modifying = false
-		raw := strings.Join(m.Inputs, "")
+		var warning tea.Cmd
 		switch item := modifyingItem.(type) {
 		case *dict.MatchResult:
-			feIndex := slices.IndexFunc(fes, func(fe *dict.FileEntries) bool {
-				return fe.ID == item.Entry.FID
-			})
-			if feIndex == -1 {
-				panic("modify item error: this item does not belong to any file")
+			fe := fileOf(fes, item.Entry)
+			if fe == nil || m.Form == nil {
+				m.Modifying, m.Form = false, nil
+				return notify("修改失败: 此项不属于任何已加载的文件")
 			}
-			fe := fes[feIndex]
-			pair, cols := dict.ParseInput(raw, slices.Index(fe.Columns, dict.COLUMN_STEM) != -1)
-			if len(pair) > 1 {
-				data, _ := dict.ParseData(pair, &cols)
-				data.ResetColumns(&fe.Columns)
-				entryRaw := data.ToString()
-				log.Printf("modify confirm item: %s\n", entryRaw)
-				item.Entry.ReRaw(entryRaw)
-				if feIndex > -1 {
-					item.Entry.ReRaw(data.ToStringWithColumns(&fes[feIndex].Columns))
-				}
-				m.Inputs = strings.Split(data.Code, "")
-				m.InputCursor = len(m.Inputs)
+			data := *item.Entry.Data() // 复制后修改，超出列声明的字段原样保留
+			data.Extra = maps.Clone(data.Extra)
+			if err := applyForm(&data, fe.Columns, m.Form); err != nil { // 继续修改
+				return tea.Batch(tui.ExitMenuCmd, notify("%v", err))
+			}
+			data.ResetColumns(&fe.Columns)
+			var blocked bool
+			if blocked, warning = checkCode(opts, fe, data.Code); blocked {
+				return tea.Batch(tui.ExitMenuCmd, warning)
+			}
+			entryRaw := data.ToString()
+			slog.Debug("modify item", "raw", entryRaw)
+			if fe.Readonly {
+				warning = tea.Batch(warning, redirectToUser(data))
+			} else if err := dc.ReRaw(item.Entry, entryRaw); err != nil {
+				warning = tea.Batch(warning, notify("修改失败: %v", err))
 			}
+			m.Inputs = strings.Split(data.Code, "")
+			m.InputCursor = len(m.Inputs)
 			dc.ResetMatcher()
 			FlushAndSync(opts, dc, opts.SyncOnChange)
 		}
-		return tui.ExitMenuCmd
+		m.Modifying, m.Form = false, nil
+		return tea.Batch(tui.ExitMenuCmd, warning)
 	}}
 
 	// 退出到列表菜单
@@ -187,8 +327,14 @@ func Start(opts *Options) {
 	showMenus := []*tui.Menu{&menuNameAdd, &menuNameModify, &menuNameDelete, &menuNameBack}
 	modifyingMenus := []*tui.Menu{&menuNameConfirm, &menuNameBack}
 	helpMenus := []*tui.Menu{&menuNameBack}
-	exportMenus := []*tui.Menu{&menuNameBack, &menuNameBack} // will change the first element later
+	addUnmatchedMenus := []*tui.Menu{&menuNameBack} // will change later
+	exportMenus := []*tui.Menu{&menuNameBack}       // will change later
+	previewPanel.Menus = []*tui.Menu{&menuNameBack}
+	statsPanel.Menus = []*tui.Menu{&menuNameBack}
 	menuFetcher := func(m *tui.Model) []*tui.Menu {
+		if pendingConfirm != nil {
+			return confirmMenus
+		}
 		menus := []*tui.Menu{}
 		switch m.ListManager.ListMode {
 		case tui.LIST_MODE_DICT:
@@ -200,19 +346,38 @@ func Start(opts *Options) {
 				}
 			}
 		case tui.LIST_MODE_FILE:
-			menus = showMenus
+			if addingUnmatched {
+				menus = addUnmatchedMenus
+			} else {
+				menus = showMenus
+			}
 		case tui.LIST_MODE_HELP:
 			menus = helpMenus
 		case tui.LIST_MODE_EXPO:
 			menus = exportMenus
+		default:
+			if p := m.ListManager.Panel(); p != nil {
+				menus = p.Menus
+			}
 		}
 		if len(menus) > 0 && m.MenuIndex >= len(menus) {
 			m.MenuIndex = 0
 		}
 		return menus
 	}
-	model := tui.NewModel(listManager, menuFetcher)
+	model, err := tui.NewModel(listManager, menuFetcher)
+	if err != nil {
+		return nil, nil, err
+	}
 	teaProgram := tea.NewProgram(model, tea.WithAltScreen())
+	rimeDeployer.SetCommand(opts.RestartRimeCmd)
+	rimeDeployer.SetPostDeploy(opts.Hooks.PostDeploy, opts.ConfigPath)
+	setNotifier(func(msg string) {
+		teaProgram.Send(tui.NotifitionMsg(msg))
+	})
+	setReloadedNotifier(func(msg string) {
+		teaProgram.Send(tui.ReloadedMsg(msg))
+	})
 
 	listManager.ExportOptions = []tui.ItemRender{
 		tui.StringRender("字词"),
@@ -249,7 +414,10 @@ func Start(opts *Options) {
 			}
 			time.Sleep(time.Second)
 			if len(columns) > 0 {
-				dc.ExportDict(filePath, columns, opts.ExportWithSort)
+				if err := dc.ExportDict(filePath, columns, opts.ExportWithSort); err != nil {
+					teaProgram.Send(tui.NotifitionMsg(fmt.Sprintf("导出码表失败: %v", err)))
+					return
+				}
 				teaProgram.Send(tui.NotifitionMsg("完成导出码表 > exported_dict.txt"))
 			} else {
 				teaProgram.Send(tui.NotifitionMsg("没有东西要导出"))
@@ -260,6 +428,278 @@ func Start(opts *Options) {
 		}
 	}}
 	exportMenus[0] = &menuNameExport
+	// 导出本次会话的变更记录
+	menuNameChangelog := tui.Menu{Name: "L导出变更记录", Cb: func(m *tui.Model) tea.Cmd {
+		m.ListManager.ListMode = tui.LIST_MODE_DICT
+		m.HideMenus()
+		path := opts.Changelog
+		if path == "" {
+			path = "changelog.txt"
+		}
+		items := append(slices.Clone(changelog), dc.Changelog()...)
+		if err := writeChangelog(path, items); err != nil {
+			return notify("%v", err)
+		}
+		return notify("完成导出变更记录(%d项，不含未写入文件的修改) > %s", len(items), path)
+	}}
+	// 格式化当前项所在的文件，完成后重新读取文件中的项
+	formatCurrFile := func(m *tui.Model, order dict.FormatOrder) tea.Cmd {
+		m.ListManager.ListMode = tui.LIST_MODE_DICT
+		m.HideMenus()
+		curr, err := listManager.Curr()
+		if err != nil {
+			return notify("没有选中的项，无法确定要格式化的文件")
+		}
+		mr, ok := curr.(*dict.MatchResult)
+		if !ok {
+			return notify("没有选中的项，无法确定要格式化的文件")
+		}
+		fe := fileOf(fes, mr.Entry)
+		if fe == nil {
+			return notify("格式化失败: 此项不属于任何已加载的文件")
+		}
+		return askConfirm(m, "格式化 "+filepath.Base(fe.FilePath), func(m *tui.Model) tea.Cmd {
+			m.HideMenus()
+			// 格式化前需等待之前的修改写入文件，在后台进行；格式化后关闭编辑表单并重新搜索
+			return func() tea.Msg {
+				msg := formatFile(opts, dc, fe, order)
+				dc.ResetMatcher()
+				return msg
+			}
+		})
+	}
+	menuNameFormatByCode := tui.Menu{Name: "F按编码格式化", Cb: func(m *tui.Model) tea.Cmd {
+		return formatCurrFile(m, dict.FORMAT_BY_CODE)
+	}}
+	menuNameFormatByText := tui.Menu{Name: "T按字词格式化", Cb: func(m *tui.Model) tea.Cmd {
+		return formatCurrFile(m, dict.FORMAT_BY_TEXT)
+	}}
+	exportMenus = []*tui.Menu{&menuNameExport, &menuNameChangelog, &menuNameFormatByCode, &menuNameFormatByText, &menuNameBack}
+
+	// 权重工具，fileOnly 表示此工具只能作用于整个文件
+	type weightTool struct {
+		name     string
+		fileOnly bool
+		apply    func(entries []*dict.Entry, fe *dict.FileEntries) (*dict.Batch, error)
+	}
+	weightTools := []weightTool{
+		{name: "按编码重排权重为连续的序号(首选为n，末选为1)",
+			apply: func(entries []*dict.Entry, _ *dict.FileEntries) (*dict.Batch, error) {
+				return dc.RenumberWeights(entries), nil
+			}},
+		{name: fmt.Sprintf("限制权重下限为 %d (weight_floor)", opts.WeightFloor),
+			apply: func(entries []*dict.Entry, _ *dict.FileEntries) (*dict.Batch, error) {
+				return dc.ClampWeights(entries, opts.WeightFloor, 0), nil
+			}},
+		{name: fmt.Sprintf("限制权重上限为 %d (weight_ceiling)", opts.WeightCeiling),
+			apply: func(entries []*dict.Entry, _ *dict.FileEntries) (*dict.Batch, error) {
+				if opts.WeightCeiling <= 0 {
+					return nil, errors.New("未在配置中设置 weight_ceiling")
+				}
+				return dc.ClampWeights(entries, math.MinInt, opts.WeightCeiling), nil
+			}},
+		{name: fmt.Sprintf("按词频表缩放权重到[%d, %d] (frequency_path)", opts.WeightFloor, opts.WeightCeiling),
+			apply: func(entries []*dict.Entry, _ *dict.FileEntries) (*dict.Batch, error) {
+				if opts.FrequencyPath == "" || opts.WeightCeiling <= 0 {
+					return nil, errors.New("未在配置中设置 frequency_path 或 weight_ceiling")
+				}
+				freq, err := dict.LoadFrequency(opts.FrequencyPath)
+				if err != nil {
+					return nil, err
+				}
+				return dc.ScaleWeights(entries, freq, opts.WeightFloor, opts.WeightCeiling), nil
+			}},
+		{name: fmt.Sprintf("导入词频表，按 %s 映射为权重 (frequency_path)", opts.FrequencyMapping),
+			apply: func(entries []*dict.Entry, _ *dict.FileEntries) (*dict.Batch, error) {
+				if opts.FrequencyPath == "" {
+					return nil, errors.New("未在配置中设置 frequency_path")
+				}
+				freq, err := dict.LoadFrequency(opts.FrequencyPath)
+				if err != nil {
+					return nil, err
+				}
+				batch, unmatched, err := dc.ImportFrequency(entries, freq, opts.FrequencyMapping, opts.WeightFloor, opts.WeightCeiling)
+				unmatchedWords = unmatched
+				return batch, err
+			}},
+		{name: "将当前项所在的文件转换为带权重的码表(按行序生成权重)", fileOnly: true,
+			apply: func(_ []*dict.Entry, fe *dict.FileEntries) (*dict.Batch, error) {
+				return dc.ToWeighted(fe)
+			}},
+		{name: "将当前项所在的文件转换为按行序排列的码表(按权重重排后移除权重列)", fileOnly: true,
+			apply: func(_ []*dict.Entry, fe *dict.FileEntries) (*dict.Batch, error) {
+				return dc.ToOrderOnly(fe)
+			}},
+	}
+	weightToolNames := make([]tui.ItemRender, len(weightTools))
+	for i, tool := range weightTools {
+		weightToolNames[i] = tui.StringRender(tool.name)
+	}
+	weightPanel.Set(weightToolNames, 0)
+	applyWeightTool := func(m *tui.Model, wholeFile bool) tea.Cmd {
+		m.ListManager.ListMode = tui.LIST_MODE_DICT
+		m.HideMenus()
+		tool := weightTools[weightPanel.Index()]
+		var fe *dict.FileEntries
+		if curr, err := listManager.Curr(); err == nil {
+			fid := curr.(*dict.MatchResult).Entry.FID
+			if i := slices.IndexFunc(fes, func(fe *dict.FileEntries) bool { return fe.ID == fid }); i != -1 {
+				fe = fes[i]
+			}
+		}
+		var entries []*dict.Entry
+		if wholeFile || tool.fileOnly {
+			if fe == nil {
+				return notify("没有选中的项，无法确定要调整的文件")
+			}
+			entries = dc.FileEntries(fe)
+		} else {
+			for _, item := range listManager.Results() {
+				entries = append(entries, item.(*dict.MatchResult).Entry)
+			}
+		}
+		unmatchedWords = nil
+		batch, err := tool.apply(entries, fe)
+		if err != nil {
+			return notify("权重工具: %v", err)
+		}
+		msg := "没有需要调整的项"
+		if batch != nil {
+			slog.Info("weight tool", "name", batch.Name, "changed", batch.Len())
+			dc.ResetMatcher()
+			listManager.ReSort()
+			FlushAndSync(opts, dc, opts.SyncOnChange)
+			msg = fmt.Sprintf("%s: 调整了 %d 项，按Ctrl+Z撤销", batch.Name, batch.Len())
+		}
+		if len(unmatchedWords) > 0 {
+			list := make([]tui.ItemRender, len(unmatchedWords))
+			for i, word := range unmatchedWords {
+				list[i] = tui.StringRender(fmt.Sprintf("%s\t词频:%d\t权重:%d", word.Text, word.Count, word.Weight))
+			}
+			unmatchedPanel.Set(list, 0)
+			m.ShowPanel(unmatchedPanel)
+			msg = fmt.Sprintf("%s; 词频表中有 %d 个字词未匹配", msg, len(unmatchedWords))
+		}
+		return notify("%s", msg)
+	}
+	undoBatch := func() tea.Cmd {
+		batch, err := dc.Undo()
+		if err != nil {
+			return notify("撤销%s失败: %v", batch.Name, err)
+		}
+		if batch == nil {
+			return notify("没有可撤销的批量调整")
+		}
+		slog.Info("undo weight tool", "name", batch.Name, "changed", batch.Len())
+		dc.ResetMatcher()
+		listManager.ReSort()
+		FlushAndSync(opts, dc, opts.SyncOnChange)
+		return notify("已撤销: %s", batch.Name)
+	}
+	// 作用于整个文件时需要确认
+	confirmWeightTool := func(m *tui.Model, wholeFile bool) tea.Cmd {
+		index := weightPanel.Index()
+		if !wholeFile && !weightTools[index].fileOnly {
+			return applyWeightTool(m, false)
+		}
+		action := "对当前项所在的整个文件" + weightTools[index].name
+		if weightTools[index].fileOnly {
+			action = weightTools[index].name // 名称中已说明作用于文件
+		}
+		return askConfirm(m, action, func(m *tui.Model) tea.Cmd {
+			weightPanel.SetIndex(index) // 确认期间可能移动了选择
+			return applyWeightTool(m, wholeFile)
+		})
+	}
+	menuNameWeightResult := tui.Menu{Name: "S搜索结果", Cb: func(m *tui.Model) tea.Cmd {
+		return confirmWeightTool(m, false)
+	}}
+	menuNameWeightFile := tui.Menu{Name: "F当前文件", Cb: func(m *tui.Model) tea.Cmd {
+		return confirmWeightTool(m, true)
+	}}
+	menuNameUndo := tui.Menu{Name: "U撤销", Cb: func(m *tui.Model) tea.Cmd {
+		m.ListManager.ListMode = tui.LIST_MODE_DICT
+		m.HideMenus()
+		return undoBatch()
+	}}
+	weightPanel.Menus = []*tui.Menu{&menuNameWeightResult, &menuNameWeightFile, &menuNameUndo, &menuNameBack}
+
+	// 将未匹配的字词按造词规则生成编码后添加到选择的文件中
+	menuNameAddUnmatched := tui.Menu{Name: "A添加到文件", Cb: func(m *tui.Model) tea.Cmd {
+		addingUnmatched = true
+		m.ListManager.ListMode = tui.LIST_MODE_FILE
+		m.ShowMenus()
+		return notify("选择要添加到的文件，回车确认")
+	}}
+	menuNameConfirmAddUnmatched := tui.Menu{Name: "C确认添加", Cb: func(m *tui.Model) tea.Cmd {
+		addingUnmatched = false
+		m.ListManager.ListMode = tui.LIST_MODE_DICT
+		m.HideMenus()
+		file, err := m.CurrFile()
+		if err != nil {
+			return notify("添加未匹配的字词: %v", err)
+		}
+		fe := file.(*dict.FileEntries)
+		batch, failed, err := dc.AddWords(fe, unmatchedWords)
+		if err != nil {
+			return notify("添加未匹配的字词: %v", err)
+		}
+		unmatchedWords = failed
+		if batch == nil {
+			return notify("没有字词能生成编码，未添加任何项")
+		}
+		slog.Info("add unmatched words", "added", batch.Len(), "failed", len(failed))
+		dc.ResetMatcher()
+		FlushAndSync(opts, dc, opts.SyncOnChange)
+		return notify("添加了 %d 个字词到 %s，%d 个无法生成编码，按Ctrl+Z撤销", batch.Len(), filepath.Base(fe.FilePath), len(failed))
+	}}
+	unmatchedPanel.Menus = []*tui.Menu{&menuNameAddUnmatched, &menuNameBack}
+	addUnmatchedMenus = []*tui.Menu{&menuNameConfirmAddUnmatched, &menuNameBack}
+
+	// 当前项的变更历史
+	var historyItems []historyItem
+	menuNameRevert := tui.Menu{Name: "R还原", Cb: func(m *tui.Model) tea.Cmd {
+		m.ListManager.ListMode = tui.LIST_MODE_DICT
+		m.HideMenus()
+		if historyPanel.Index() >= len(historyItems) {
+			return nil
+		}
+		change := historyItems[historyPanel.Index()].change
+		if i := slices.IndexFunc(fes, func(fe *dict.FileEntries) bool { return absPath(fe.FilePath) == change.FilePath }); i != -1 {
+			change.FilePath = fes[i].FilePath
+		}
+		if err := dc.RevertChange(change); err != nil {
+			return notify("还原失败: %v", err)
+		}
+		slog.Info("revert change", "change", change)
+		dc.ResetMatcher()
+		listManager.ReSort()
+		FlushAndSync(opts, dc, opts.SyncOnChange)
+		return notify("已还原: %s", change)
+	}}
+	historyPanel.Menus = []*tui.Menu{&menuNameRevert, &menuNameBack}
+
+	// 切换profile：退出Tui后重新加载词典
+	var switchTo *Options
+	profiles := profileNames(opts)
+	menuNameSwitch := tui.Menu{Name: "S切换", Cb: func(m *tui.Model) tea.Cmd {
+		m.ListManager.ListMode = tui.LIST_MODE_DICT
+		m.HideMenus()
+		if profilePanel.Index() >= len(profiles) {
+			return nil
+		}
+		name := profiles[profilePanel.Index()]
+		if name == opts.Profile {
+			return notify("当前已是profile: %s", name)
+		}
+		next, err := switchProfile(opts, name)
+		if err != nil {
+			return notify("切换profile失败: %v", err)
+		}
+		switchTo = next
+		return tea.Quit
+	}}
+	profilePanel.Menus = []*tui.Menu{&menuNameSwitch, &menuNameBack}
 
 	// events
 	exitEvent := &tui.Event{
@@ -267,10 +707,12 @@ func Start(opts *Options) {
 		Cb: func(key string, m *tui.Model) (tea.Model, tea.Cmd) {
 			if key == "esc" {
 				if m.Modifying || m.MenusShowing {
+					pendingConfirm = nil
 					if m.Modifying {
 						m.Inputs = []string{}
 						m.InputCursor = 0
 						m.Modifying = false
+						m.Form = nil
 					}
 					m.ListManager.ListMode = tui.LIST_MODE_DICT
 					m.HideMenus()
@@ -282,6 +724,20 @@ func Start(opts *Options) {
 		},
 	}
 
+	// 列出与entry编码相同的所有项，并按Rime的候选顺序排列，高亮entry所在位置
+	showPreview := func(entry *dict.Entry) {
+		candidates := dc.Candidates(entry.Data().Code)
+		list := make([]tui.ItemRender, len(candidates))
+		index := 0
+		for i, candidate := range candidates {
+			list[i] = candidate
+			if candidate.Entry == entry {
+				index = i
+			}
+		}
+		previewPanel.Set(list, index)
+	}
+
 	// 修改权重，这是一个高频操作，通过debouncer延迟同步到文件。
 	modifyWeightDebouncer := mutil.NewDebouncer(time.Millisecond * 1000) // 一秒后
 	modifyWeightEvent := &tui.Event{
@@ -313,7 +769,25 @@ func Start(opts *Options) {
 			}
 			changed := false
 			currEntry := curr.(*dict.MatchResult).Entry
-			currEntryData := currEntry.Data()
+			// 不带权重的码表依靠行序决定候选顺序，将所在的行移动到编码相同的相邻项之前或之后
+			if fe := fileOf(fes, currEntry); (key == "ctrl+up" || key == "ctrl+down") && fe != nil && !slices.Contains(fe.Columns, dict.COLUMN_WEIGHT) {
+				moved, err := dc.MoveLine(currEntry, key == "ctrl+down")
+				if err != nil {
+					return m, notify("调整顺序失败: %v", err)
+				}
+				if moved == nil {
+					return m, nil
+				}
+				dc.ResetMatcher()
+				if listManager.Showing(previewPanel) {
+					showPreview(moved)
+				}
+				modifyWeightDebouncer.Do(func() {
+					FlushAndSync(opts, dc, opts.SyncOnChange)
+				})
+				return m, func() tea.Msg { return tui.FreshListMsg(1) }
+			}
+			currEntryData := *currEntry.Data() // 复制后修改，再通过dc.ReRaw写回
 			if key == "ctrl+up" || key == "ctrl+down" {
 				list, _ := listManager.List()
 				if len(list) <= 1 {
@@ -352,14 +826,20 @@ func Start(opts *Options) {
 				changed = true
 			}
 			if changed {
-				currEntry.ReRaw(currEntryData.ToString())
+				if err := dc.ReRaw(currEntry, currEntryData.ToString()); err != nil {
+					return m, notify("修改权重失败: %v", err)
+				}
 				listManager.ReSort()
-				list, _ := listManager.List()
-				// 重新设置 listManager 的 currIndex为当前修改的项
-				for i, item := range list {
-					if item.(*dict.MatchResult).Entry == currEntry {
-						listManager.SetIndex(i)
-						break
+				if listManager.Showing(previewPanel) {
+					showPreview(currEntry)
+				} else {
+					list, _ := listManager.List()
+					// 重新设置 listManager 的 currIndex为当前修改的项
+					for i, item := range list {
+						if item.(*dict.MatchResult).Entry == currEntry {
+							listManager.SetIndex(i)
+							break
+						}
 					}
 				}
 				// 延迟同步到文件
@@ -401,6 +881,134 @@ func Start(opts *Options) {
 			}
 		},
 	}
+	// 预览当前项的编码在Rime中的候选顺序
+	showPreviewEvent := &tui.Event{
+		Keys: []string{"ctrl+p"},
+		Cb: func(key string, m *tui.Model) (tea.Model, tea.Cmd) {
+			if m.ListManager.Showing(previewPanel) {
+				return m, tui.ExitMenuCmd
+			}
+			if m.ListManager.ListMode != tui.LIST_MODE_DICT || m.Modifying {
+				return m, nil
+			}
+			curr, err := listManager.Curr()
+			if err != nil {
+				return m, nil
+			}
+			currEntry := curr.(*dict.MatchResult).Entry
+			showPreview(currEntry)
+			m.ShowPanel(previewPanel)
+			code := currEntry.Data().Code
+			return m, func() tea.Msg {
+				return tui.NotifitionMsg(fmt.Sprintf("编码 [%s] 的候选顺序", code))
+			}
+		},
+	}
+	// 显示权重工具
+	showWeightToolsEvent := &tui.Event{
+		Keys: []string{"ctrl+w"},
+		Cb: func(key string, m *tui.Model) (tea.Model, tea.Cmd) {
+			if m.ListManager.Showing(weightPanel) {
+				return m, tui.ExitMenuCmd
+			}
+			if m.Modifying {
+				return m, nil
+			}
+			m.ShowPanel(weightPanel)
+			return m, func() tea.Msg { return 0 } // trigger bubbletea update
+		},
+	}
+	// 显示词典的统计数据
+	showStatsEvent := &tui.Event{
+		Keys: []string{"ctrl+t"},
+		Cb: func(key string, m *tui.Model) (tea.Model, tea.Cmd) {
+			if m.ListManager.Showing(statsPanel) {
+				return m, tui.ExitMenuCmd
+			}
+			if m.Modifying {
+				return m, nil
+			}
+			lines := statsLines(dc.Stats())
+			slices.Reverse(lines) // 列表从下往上显示
+			list := make([]tui.ItemRender, len(lines))
+			for i, line := range lines {
+				list[i] = tui.StringRender(line)
+			}
+			statsPanel.Set(list, len(list)-1)
+			m.ShowPanel(statsPanel)
+			return m, func() tea.Msg { return 0 } // trigger bubbletea update
+		},
+	}
+	// 撤销最近一次的批量调整
+	undoEvent := &tui.Event{
+		Keys: []string{"ctrl+z"},
+		Cb: func(key string, m *tui.Model) (tea.Model, tea.Cmd) {
+			if m.Modifying {
+				return m, nil
+			}
+			return m, undoBatch()
+		},
+	}
+	// 浏览当前项的变更历史
+	showHistoryEvent := &tui.Event{
+		Keys: []string{"ctrl+g"},
+		Cb: func(key string, m *tui.Model) (tea.Model, tea.Cmd) {
+			if m.ListManager.Showing(historyPanel) {
+				return m, tui.ExitMenuCmd
+			}
+			if m.ListManager.ListMode != tui.LIST_MODE_DICT || m.Modifying {
+				return m, nil
+			}
+			if !opts.GitHistory {
+				return m, notify("未启用git_history")
+			}
+			curr, err := listManager.Curr()
+			if err != nil {
+				return m, nil
+			}
+			data := curr.(*dict.MatchResult).Entry.Data()
+			items, err := gitHistory(gitRepoPath(opts), data.Text, data.Code)
+			if err != nil {
+				return m, notify("读取变更历史失败: %v", err)
+			}
+			if len(items) == 0 {
+				return m, notify("[%s %s] 没有变更历史", data.Text, data.Code)
+			}
+			historyItems = items
+			list := make([]tui.ItemRender, len(items))
+			for i, item := range items {
+				list[i] = tui.StringRender(item.String())
+			}
+			historyPanel.Set(list, 0)
+			m.ShowPanel(historyPanel)
+			return m, notify("[%s %s] 的变更历史，选择后还原", data.Text, data.Code)
+		},
+	}
+	// 显示配置文件中的profile，选择后切换
+	showProfilesEvent := &tui.Event{
+		Keys: []string{"ctrl+r"},
+		Cb: func(key string, m *tui.Model) (tea.Model, tea.Cmd) {
+			if m.ListManager.Showing(profilePanel) {
+				return m, tui.ExitMenuCmd
+			}
+			if m.ListManager.ListMode != tui.LIST_MODE_DICT || m.Modifying {
+				return m, nil
+			}
+			if len(profiles) == 0 {
+				return m, notify("配置文件中没有profiles")
+			}
+			list := make([]tui.ItemRender, len(profiles))
+			for i, name := range profiles {
+				if name == opts.Profile {
+					name += " (当前)"
+				}
+				list[i] = tui.StringRender(name)
+			}
+			profilePanel.Set(list, slices.Index(profiles, opts.Profile))
+			m.ShowPanel(profilePanel)
+			return m, notify("选择要切换的profile，切换前会写入所有修改")
+		},
+	}
 	// 重新部署，强制保存变更到文件，并执行rime部署指令。
 	redeployEvent := &tui.Event{
 		Keys: []string{"ctrl+s"},
@@ -419,17 +1027,30 @@ func Start(opts *Options) {
 		modifyWeightEvent,
 		showHelpEvent,
 		showExportDictEvent,
+		showPreviewEvent,
+		showWeightToolsEvent,
+		showStatsEvent,
+		undoEvent,
+		showHistoryEvent,
+		showProfilesEvent,
 	}
 	model.AddEvent(events...)
-	// 输入处理 搜索
+	// 输入处理 搜索，Tui退出后结束
+	searchDone := make(chan struct{})
 	go func() {
 		var cancelFunc context.CancelFunc
 		resultChan := make(chan dict.MatchResultChunk)
 		timer := time.NewTicker(time.Millisecond * 100) // debounce
+		defer timer.Stop()
 		hasAppend := false
 		searchVersion := 0
 		for {
 			select {
+			case <-searchDone:
+				if cancelFunc != nil {
+					cancelFunc()
+				}
+				return
 			case raw := <-searchChan: // 等待搜索term
 				ctx, cancel := context.WithCancel(context.Background())
 				if cancelFunc != nil {
@@ -478,32 +1099,174 @@ func Start(opts *Options) {
 		}
 	}()
 
-	if _, err := teaProgram.Run(); err != nil {
-		fmt.Printf("Tui Program Error: %v\n", err)
-		os.Exit(1)
+	_, err = teaProgram.Run()
+	close(searchDone)
+	// 退出后等待仍在进行的写入与部署完成，通知输出到终端
+	setNotifier(nil)
+	setReloadedNotifier(nil)
+	flushQueue.Wait()
+	rimeDeployer.Wait()
+	if err != nil {
+		return nil, dc, fmt.Errorf("Tui运行出错: %w", err)
+	}
+	// 之前写入失败的变更仍在内存中，最后再尝试一次，仍失败时返回错误
+	if _, err := flushWithHooks(opts, dc); err != nil {
+		return nil, dc, fmt.Errorf("部分变更未能写入文件: %w", err)
 	}
+	return switchTo, dc, nil
 }
 
-var lock *mutil.FLock = mutil.NewFLock()
+// 运行直接以参数指定码表文件的子命令
+func runFileCommand(opts *Options) (err error) {
+	switch opts.Command {
+	case "diff":
+		if len(opts.Args) != 2 {
+			err = errors.New("用法: rimedm diff A B")
+			break
+		}
+		err = runDiff(os.Stdout, opts.Args[0], opts.Args[1])
+	case "merge":
+		if len(opts.Args) != 3 {
+			err = errors.New("用法: rimedm merge base ours theirs [-o 输出文件]")
+			break
+		}
+		err = runMerge(opts.Args[0], opts.Args[1], opts.Args[2], opts.Output)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", opts.Command, err)
+	}
+	return nil
+}
 
-// 同步变更到文件中，如果启用了自动部署Rime的功能则调用部署指令
-func FlushAndSync(opts *Options, dc *dict.Dictionary, sync bool) {
-	// 此操作的阻塞的，但可能被异步调用，因此加上防止重复调用机制
-	if !lock.Should() {
+var (
+	notifierMu       sync.Mutex
+	notifier         func(msg string)
+	reloadedNotifier func(msg string)
+)
+
+// 设置通知用户的方式，为nil时输出到终端
+func setNotifier(fn func(msg string)) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	notifier = fn
+}
+
+// 设置通知码表文件已重新读取的方式，Tui据此关闭编辑表单并重新搜索；为nil时按普通通知处理
+func setReloadedNotifier(fn func(msg string)) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	reloadedNotifier = fn
+}
+
+// 通知用户码表文件已重新读取，此前持有的项已被替换
+func notifyReloaded(msg string) {
+	notifierMu.Lock()
+	fn := reloadedNotifier
+	notifierMu.Unlock()
+	if fn == nil {
+		notifyUser(msg)
 		return
 	}
-	defer lock.Done()
+	fn(msg)
+}
+
+// 通知用户，Tui运行时显示在Tui中，否则输出到终端，可在任意goroutine中调用
+func notifyUser(msg string) {
+	notifierMu.Lock()
+	fn := notifier
+	notifierMu.Unlock()
+	if fn == nil {
+		fmt.Fprintln(os.Stderr, msg)
+		return
+	}
+	fn(msg)
+}
+
+// 检查编码能否被方案输入，返回是否阻止添加或修改，以及要显示的通知
+func checkCode(opts *Options, fe *dict.FileEntries, code string) (bool, tea.Cmd) {
+	if opts.CodeCheck == CODE_CHECK_OFF {
+		return false, nil
+	}
+	err := fe.CodeRule.Check(code)
+	if err == nil {
+		return false, nil
+	}
+	if opts.CodeCheck == CODE_CHECK_WARN {
+		return false, notify("警告: %v", err)
+	}
+	return true, notify("%v，请修改编码(可在配置中设置code_check)", err)
+}
+
+// entry所在的文件
+func fileOf(fes []*dict.FileEntries, entry *dict.Entry) *dict.FileEntries {
+	for _, fe := range fes {
+		if fe.ID == entry.FID {
+			return fe
+		}
+	}
+	return nil
+}
+
+// 返回在Tui中显示通知的命令
+func notify(format string, args ...any) tea.Cmd {
+	return func() tea.Msg {
+		return tui.NotifitionMsg(fmt.Sprintf(format, args...))
+	}
+}
+
+// 输出加载码表时的警告，无法解析列序时附上解决方法
+func printWarning(w io.Writer, warning error) {
+	fmt.Fprintf(w, "\x1b[31m警告：%v\x1b[0m\n", warning)
+	if errors.Is(warning, dict.ErrColumnAmbiguous) {
+		fmt.Fprint(w, `码表中的第一个有效项必须包含 英文和汉字，以制表符隔开，如 [nihao 你好]、[你好 nihao]
+！！！现启用默认的列序： [字词 编码 权重]，若与码表实际的列序不同，将导致无法搜索与修改！
+方式一：使码表的第一个有效项包含英文和汉字；
+方式二：在码表的配置中指定columns
+columns:
+  - text
+  - weight
+  - code
+`)
+	}
+}
+
+// 写入文件的队列，同一时间只有一次写入，写入期间的请求会合并为下一次写入
+var flushQueue = mutil.NewCoalescer()
+
+// 在后台同步变更到文件中，如果启用了自动部署Rime的功能则调用部署指令。
+// 不会阻塞调用者(如Tui的Update)，写入或钩子失败时通过notifyUser通知；可通过 flushQueue.Wait 等待写入完成
+func FlushAndSync(opts *Options, dc *dict.Dictionary, sync bool) {
 	if !sync {
 		return
 	}
-	if dc.Flush() && opts.RestartRimeCmd != "" {
-		// TODO: check RestartRimeCmd, if weasel updated, the program path may be changed
-		cmd := mutil.Run(opts.RestartRimeCmd)
-		err := cmd.Run()
-		if err != nil {
-			panic(fmt.Errorf("exec restart rime cmd error:%v", err))
+	flushQueue.Trigger(func() {
+		flush(opts, dc)
+	})
+}
+
+// 同步变更到文件中，阻塞到调用之前的变更已写入文件。
+// 通知用户时需要Tui的事件循环，因此不能在Tui的Update中调用，应在tea.Cmd中调用
+func flushNow(opts *Options, dc *dict.Dictionary) {
+	flushQueue.Do(func() {
+		flush(opts, dc)
+	})
+}
+
+func flush(opts *Options, dc *dict.Dictionary) {
+	changes, err := flushWithHooks(opts, dc)
+	if err != nil {
+		slog.Error("flush dictionary failed", "err", err)
+		notifyUser("写入文件失败: " + err.Error())
+	}
+	if len(changes) > 0 && opts.GitHistory {
+		if err := gitCommit(gitRepoPath(opts), changes); err != nil {
+			slog.Error("git commit failed", "err", err)
+			notifyUser("git提交失败: " + err.Error())
 		}
 	}
+	if len(changes) > 0 {
+		rimeDeployer.Deploy(changes...)
+	}
 }
 
 func parseColumnsFromArgments(s string) []dict.Column {
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MapoMagpie/rimedm/dict"
+)
+
+// Tui的事件循环忙于Update时无法接收通知，写入失败的通知不应阻塞Update
+func Test_FlushAndSync_notBlocking(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.dict.yaml")
+	if err := os.WriteFile(path, []byte("你好\tnau\t1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := dict.Open([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Update(dc.Find("你好", "")[0], func(data *dict.Data) { data.Weight = 5 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil { // 使写入失败
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	msgs := make(chan string, 1)
+	setNotifier(func(msg string) {
+		<-release
+		msgs <- msg
+	})
+	defer setNotifier(nil)
+
+	returned := make(chan struct{})
+	go func() {
+		FlushAndSync(&Options{}, dc, true)
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("FlushAndSync() blocked on notification")
+	}
+	close(release)
+	flushQueue.Wait()
+	if msg := <-msgs; !strings.HasPrefix(msg, "写入文件失败") {
+		t.Errorf("notification = %q", msg)
+	}
+	if len(dc.Pending()) != 1 {
+		t.Errorf("failed changes should stay pending")
+	}
+}
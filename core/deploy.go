@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MapoMagpie/rimedm/dict"
+	mutil "github.com/MapoMagpie/rimedm/util"
+)
+
+var (
+	deployTimeout = 30 * time.Second
+	deployRetries = 3
+	deployBackoff = time.Second // 每次重试的等待时间翻倍
+)
+
+// deployer 在后台执行重新部署Rime的命令，同一时间只有一次部署在执行，
+// 部署期间的请求会合并为一次，在当前部署结束后执行
+type deployer struct {
+	mu         sync.Mutex
+	cmd        string
+	hook       string        // 部署成功后执行的post_deploy钩子
+	configPath string        // 传给钩子的配置文件路径
+	changes    []dict.Change // 等待部署的变更，传给钩子
+	queue      *mutil.Coalescer
+}
+
+func newDeployer() *deployer {
+	return &deployer{queue: mutil.NewCoalescer()}
+}
+
+var rimeDeployer = newDeployer()
+
+// SetCommand 设置部署命令，为空时不部署
+func (d *deployer) SetCommand(cmd string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cmd = cmd
+}
+
+// SetPostDeploy 设置部署成功后执行的钩子命令，为空时不执行
+func (d *deployer) SetPostDeploy(hook, configPath string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hook, d.configPath = hook, configPath
+}
+
+// Deploy 请求一次部署，不会阻塞，changes为此次部署包含的变更
+func (d *deployer) Deploy(changes ...dict.Change) {
+	d.mu.Lock()
+	cmd := d.cmd
+	if cmd != "" {
+		d.changes = append(d.changes, changes...)
+	}
+	d.mu.Unlock()
+	if cmd == "" {
+		return
+	}
+	d.queue.Trigger(d.deploy)
+}
+
+// Wait 等待正在执行与等待执行的部署完成
+func (d *deployer) Wait() {
+	d.queue.Wait()
+}
+
+func (d *deployer) deploy() {
+	d.mu.Lock()
+	cmd, hook, configPath, changes := d.cmd, d.hook, d.configPath, d.changes
+	d.changes = nil
+	d.mu.Unlock()
+	start := time.Now()
+	if err := d.runWithRetry(cmd); err != nil {
+		slog.Error("deploy rime failed", "cmd", cmd, "err", err)
+		notifyUser(fmt.Sprintf("Rime部署失败: %v", err))
+		return
+	}
+	slog.Info("deploy rime", "cmd", cmd, "elapsed", time.Since(start))
+	notifyUser(fmt.Sprintf("Rime部署完成 (%.1fs)", time.Since(start).Seconds()))
+	if err := runHook(HOOK_POST_DEPLOY, hook, configPath, changes); err != nil {
+		notifyUser(err.Error())
+	}
+}
+
+// 执行部署命令，失败时按退避时间重试；小狼毫升级后程序路径会改变，此时重新查找部署程序
+func (d *deployer) runWithRetry(cmd string) (err error) {
+	backoff := deployBackoff
+	for attempt := 1; attempt <= deployRetries; attempt++ {
+		if err = runDeployCmd(cmd); err == nil {
+			return nil
+		}
+		slog.Warn("deploy rime attempt failed", "attempt", attempt, "err", err)
+		if newCmd := rediscoverDeployCmd(cmd); newCmd != "" {
+			d.mu.Lock()
+			d.cmd = newCmd
+			d.mu.Unlock()
+			notifyUser("部署命令已失效，已更新为: " + newCmd + " ，请同步修改配置文件中的restart_rime_cmd")
+			cmd = newCmd
+			continue
+		}
+		if attempt < deployRetries {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+func runDeployCmd(command string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deployTimeout)
+	defer cancel()
+	cmd := mutil.RunContext(ctx, command)
+	cmd.WaitDelay = time.Second // 超时后不再等待子进程关闭输出
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		slog.Debug("deploy rime output", "output", string(out))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("超时(%v)", deployTimeout)
+	}
+	if err != nil {
+		if msg := lastLine(string(out)); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// 当前命令为小狼毫的部署程序时，查找已安装的最新版本，若与当前命令不同则返回新命令
+func rediscoverDeployCmd(cmd string) string {
+	if !strings.Contains(cmd, "WeaselDeployer") {
+		return ""
+	}
+	newCmd := weaselDeployCmd()
+	if newCmd == "" || newCmd == cmd {
+		return ""
+	}
+	return newCmd
+}
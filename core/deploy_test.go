@@ -0,0 +1,64 @@
+//go:build !windows
+
+package core
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_deployer(t *testing.T) {
+	deployTimeout, deployBackoff = 200*time.Millisecond, time.Millisecond
+	tests := []struct {
+		name string
+		cmd  string
+		want string
+	}{
+		{name: "success", cmd: "echo ok", want: "Rime部署完成"},
+		{name: "failure", cmd: "echo 找不到fcitx5 >&2; exit 1", want: "Rime部署失败: exit status 1: 找不到fcitx5"},
+		{name: "timeout", cmd: "sleep 5", want: "Rime部署失败: 超时"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			msgs := make([]string, 0)
+			d := newDeployer()
+			d.SetCommand(tt.cmd)
+			setNotifier(func(msg string) {
+				mu.Lock()
+				defer mu.Unlock()
+				msgs = append(msgs, msg)
+			})
+			defer setNotifier(nil)
+			d.Deploy()
+			d.Wait()
+			if len(msgs) != 1 || !strings.HasPrefix(msgs[0], tt.want) {
+				t.Errorf("deploy %q, msgs = %q, want prefix %q", tt.cmd, msgs, tt.want)
+			}
+		})
+	}
+}
+
+func Test_deployer_coalesce(t *testing.T) {
+	var mu sync.Mutex
+	count := 0
+	d := newDeployer()
+	d.SetCommand("sleep 0.1")
+	setNotifier(func(string) {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+	})
+	defer setNotifier(nil)
+	d.Deploy()
+	time.Sleep(30 * time.Millisecond) // 等待第一次部署开始
+	for range 4 {
+		d.Deploy()
+	}
+	d.Wait()
+	if count != 2 { // 第一次部署，以及部署期间的请求合并后的一次
+		t.Errorf("deploy count = %d, want 2", count)
+	}
+}
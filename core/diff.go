@@ -0,0 +1,70 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/MapoMagpie/rimedm/dict"
+)
+
+// 比较两个码表文件，以 字词+编码 作为项的标识，输出新增、删除、修改的项
+func runDiff(w io.Writer, oldPath, newPath string) error {
+	a, err := dict.LoadFile(oldPath)
+	if err != nil {
+		return err
+	}
+	b, err := dict.LoadFile(newPath)
+	if err != nil {
+		return err
+	}
+	items := dict.Diff(a.Entries, b.Entries)
+	counts := make(map[dict.DiffType]int)
+	for _, item := range items {
+		counts[item.Type]++
+		if _, err := fmt.Fprintln(w, item.String()); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "新增: %d, 删除: %d, 修改: %d\n", counts[dict.DIFF_ADD], counts[dict.DIFF_DELETE], counts[dict.DIFF_MODIFY])
+	return nil
+}
+
+// 三方合并码表文件，将theirs相对base的变更合并到ours中，保留ours的头部与注释，
+// 结果写入output，output为空时输出到标准输出流
+func runMerge(basePath, oursPath, theirsPath, output string) error {
+	base, err := dict.LoadFile(basePath)
+	if err != nil {
+		return err
+	}
+	ours, err := dict.LoadFile(oursPath)
+	if err != nil {
+		return err
+	}
+	theirs, err := dict.LoadFile(theirsPath)
+	if err != nil {
+		return err
+	}
+	conflicts := dict.Merge(base.Entries, ours, theirs.Entries)
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "冲突(保留ours): base: [%s] ours: [%s] theirs: [%s]\n", rawOrNone(c.Base), rawOrNone(c.Ours), rawOrNone(c.Theirs))
+	}
+	bs := ours.Bytes()
+	if output == "" {
+		_, err = os.Stdout.Write(bs)
+	} else {
+		err = os.WriteFile(output, bs, 0666)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "合并完成，冲突: %d\n", len(conflicts))
+	return nil
+}
+
+func rawOrNone(entry *dict.Entry) string {
+	if entry == nil {
+		return "无"
+	}
+	return entry.Raw()
+}
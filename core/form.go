@@ -0,0 +1,58 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/MapoMagpie/rimedm/dict"
+	"github.com/MapoMagpie/rimedm/tui"
+)
+
+// 列在修改表单中显示的名称
+func columnName(col dict.Column) string {
+	switch col {
+	case dict.COLUMN_TEXT:
+		return "字词"
+	case dict.COLUMN_CODE:
+		return "编码"
+	case dict.COLUMN_WEIGHT:
+		return "权重"
+	case dict.COLUMN_STEM:
+		return "造词码"
+	}
+	return string(col)
+}
+
+// 按文件的列序生成修改entry的表单，每列一个字段
+func entryForm(opts *Options, fe *dict.FileEntries, entry *dict.Entry) *tui.Form {
+	data := entry.Data()
+	fields := make([]*tui.Field, len(fe.Columns))
+	for i, col := range fe.Columns {
+		validate := col.Check
+		if col == dict.COLUMN_CODE && opts.CodeCheck == CODE_CHECK_BLOCK {
+			validate = func(value string) error {
+				if err := col.Check(value); err != nil {
+					return err
+				}
+				return fe.CodeRule.Check(value)
+			}
+		}
+		fields[i] = tui.NewField(columnName(col), data.Get(col), validate)
+	}
+	return tui.NewForm(fields...)
+}
+
+// 检查表单并将其内容写入data，表单的字段与cols一一对应
+func applyForm(data *dict.Data, cols []dict.Column, form *tui.Form) error {
+	if len(form.Fields) != len(cols) {
+		return fmt.Errorf("码表的列已改变，请重新修改")
+	}
+	if err := form.Validate(); err != nil {
+		return err
+	}
+	for i, col := range cols {
+		if err := data.Set(col, form.Fields[i].String()); err != nil {
+			return fmt.Errorf("%s: %w", columnName(col), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MapoMagpie/rimedm/dict"
+)
+
+func Test_entryForm(t *testing.T) {
+	fe := &dict.FileEntries{ID: 1, Columns: []dict.Column{dict.COLUMN_TEXT, dict.COLUMN_CODE, dict.COLUMN_WEIGHT, "comment"}}
+	entry := dict.NewEntry([]byte("你好	nau	10	常用"), fe.ID, 0, 0, &fe.Columns)
+	opts := &Options{CodeCheck: CODE_CHECK_OFF}
+	form := entryForm(opts, fe, entry)
+	got := make([]string, 0)
+	for _, field := range form.Fields {
+		got = append(got, field.Name+"="+field.String())
+	}
+	if want := "字词=你好 编码=nau 权重=10 comment=常用"; strings.Join(got, " ") != want {
+		t.Fatalf("entryForm() = %q, want %q", got, want)
+	}
+
+	// 字词为数字、编码包含空格，不再被误判
+	form.Fields[0].Value = strings.Split("100", "")
+	form.Fields[1].Value = strings.Split("yi bai", "")
+	data := *entry.Data()
+	if err := applyForm(&data, fe.Columns, form); err != nil {
+		t.Fatalf("applyForm() error = %v", err)
+	}
+	if got, want := data.ToString(), "100	yi bai	10	常用"; got != want {
+		t.Errorf("applyForm() = %q, want %q", got, want)
+	}
+
+	form.Fields[2].Value = strings.Split("ten", "")
+	form.Index = 0
+	if err := applyForm(&data, fe.Columns, form); err == nil || form.Index != 2 {
+		t.Errorf("applyForm() with invalid weight error = %v, index = %d", err, form.Index)
+	}
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MapoMagpie/rimedm/dict"
+	"github.com/MapoMagpie/rimedm/tui"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// 解析fmt命令的排序方式，默认按编码排序
+func formatOrderOf(args []string) (dict.FormatOrder, error) {
+	if len(args) == 0 {
+		return dict.FORMAT_BY_CODE, nil
+	}
+	if len(args) == 1 {
+		switch args[0] {
+		case "code":
+			return dict.FORMAT_BY_CODE, nil
+		case "text":
+			return dict.FORMAT_BY_TEXT, nil
+		}
+	}
+	return dict.FORMAT_BY_CODE, errors.New("用法: rimedm fmt [code|text]")
+}
+
+// 格式化所有可写的码表文件，跳过只读文件
+func runFormat(w io.Writer, opts *Options, dc *dict.Dictionary, fes []*dict.FileEntries) error {
+	order, err := formatOrderOf(opts.Args)
+	if err != nil {
+		return err
+	}
+	formatted := make([]string, 0)
+	var errs []error
+	for _, fe := range fes {
+		if fe.Readonly {
+			continue
+		}
+		stats, err := dc.Format(fe, order)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !stats.Changed {
+			fmt.Fprintf(w, "%s: 无需格式化\n", fe.FilePath)
+			continue
+		}
+		formatted = append(formatted, fe.FilePath)
+		fmt.Fprintf(w, "%s: 整理了 %d 项，删除了 %d 个重复项\n", fe.FilePath, stats.Entries, stats.Duplicates)
+	}
+	if len(formatted) > 0 {
+		if opts.GitHistory {
+			if err := gitCommitFiles(gitRepoPath(opts), formatted, formatMessage(gitRepoPath(opts), formatted)); err != nil {
+				fmt.Fprintf(os.Stderr, "git提交失败: %v\n", err)
+			}
+		}
+		rimeDeployer.SetCommand(opts.RestartRimeCmd)
+		rimeDeployer.SetPostDeploy(opts.Hooks.PostDeploy, opts.ConfigPath)
+		rimeDeployer.Deploy()
+		rimeDeployer.Wait()
+	}
+	return errors.Join(errs...)
+}
+
+// 格式化码表文件的git提交信息
+func formatMessage(repo string, files []string) string {
+	lines := make([]string, len(files))
+	for i, file := range files {
+		lines[i] = relPath(repo, file)
+	}
+	return fmt.Sprintf("rimedm: 格式化 %d 个码表文件\n\n%s\n", len(files), strings.Join(lines, "\n"))
+}
+
+// 写入所有修改后格式化fe所在的文件，返回要在Tui中显示的通知；格式化后fe中的项已被替换，此时返回 tui.ReloadedMsg。
+// 会阻塞到写入完成，不能在Tui的Update中调用
+func formatFile(opts *Options, dc *dict.Dictionary, fe *dict.FileEntries, order dict.FormatOrder) tea.Msg {
+	flushNow(opts, dc)
+	name := filepath.Base(fe.FilePath)
+	stats, err := dc.Format(fe, order)
+	if err != nil {
+		return tui.NotifitionMsg(fmt.Sprintf("格式化 %s 失败: %v", name, err))
+	}
+	if !stats.Changed {
+		return tui.NotifitionMsg(fmt.Sprintf("%s 无需格式化", name))
+	}
+	if opts.GitHistory {
+		repo := gitRepoPath(opts)
+		if err := gitCommitFiles(repo, []string{fe.FilePath}, formatMessage(repo, []string{fe.FilePath})); err != nil {
+			slog.Error("git commit failed", "err", err)
+			notifyUser("git提交失败: " + err.Error())
+		}
+	}
+	rimeDeployer.Deploy()
+	return tui.ReloadedMsg(fmt.Sprintf("已格式化 %s: 整理了 %d 项，删除了 %d 个重复项", name, stats.Entries, stats.Duplicates))
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MapoMagpie/rimedm/dict"
+)
+
+func Test_runFormat(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.dict.yaml")
+	b := filepath.Join(dir, "b.dict.yaml")
+	if err := os.WriteFile(a, []byte("---\nname: a\n...\n你\tni\t1 \n那\tna\t1\n那\tna\t1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("---\nname: b\n...\n哪\tna\t1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fes := make([]*dict.FileEntries, 0)
+	for _, path := range []string{a, b} {
+		fe, err := dict.LoadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fes = append(fes, fe)
+	}
+	dc := dict.NewDictionary(fes, nil)
+	if err := runFormat(&bytes.Buffer{}, &Options{Args: []string{"weight"}}, dc, fes); err == nil {
+		t.Errorf("runFormat() with unknown order should fail")
+	}
+	var out bytes.Buffer
+	if err := runFormat(&out, &Options{}, dc, fes); err != nil {
+		t.Fatal(err)
+	}
+	want := a + ": 整理了 2 项，删除了 1 个重复项\n" + b + ": 无需格式化\n"
+	if out.String() != want {
+		t.Errorf("runFormat() output = %q, want %q", out.String(), want)
+	}
+	if bs, _ := os.ReadFile(a); string(bs) != "---\nname: a\n...\n那\tna\t1\n你\tni\t1\n" {
+		t.Errorf("formatted file = %q", bs)
+	}
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Rime前端的用户目录与重新部署的命令
+type rimeFrontend struct {
+	Name      string // 生成配置文件时作为profile的名称
+	Dir       string
+	DeployCmd string // 为空时需手动部署，如同文输入法(Trime)
+}
+
+const (
+	fcitx5DeployCmd   = "dbus-send --session --print-reply --dest=org.fcitx.Fcitx5 /controller org.fcitx.Fcitx.Controller1.SetConfig string:'fcitx://config/addon/rime' variant:string:''"
+	fcitx4DeployCmd   = "fcitx-remote -r"
+	ibusDeployCmd     = "ibus restart"
+	squirrelDeployCmd = "\"/Library/Input Methods/Squirrel.app/Contents/MacOS/Squirrel\" --reload"
+)
+
+// 系统goos中可能的Rime前端，按优先级排列。userDir为环境变量RIME_USER_DIR，不为空时最优先
+func rimeFrontendCandidates(goos, home, configDir, userDir string) []rimeFrontend {
+	frontends := make([]rimeFrontend, 0)
+	if userDir != "" {
+		frontends = append(frontends, rimeFrontend{"custom", userDir, ""})
+	}
+	switch goos {
+	case "windows":
+		frontends = append(frontends, rimeFrontend{"weasel", filepath.Join(configDir, "Rime"), weaselDeployCmd()})
+	case "darwin":
+		frontends = append(frontends, rimeFrontend{"squirrel", filepath.Join(home, "Library", "Rime"), squirrelDeployCmd})
+	case "android":
+		frontends = append(frontends,
+			rimeFrontend{"trime", "/sdcard/rime", ""},
+			rimeFrontend{"trime-termux", filepath.Join(home, "storage", "shared", "rime"), ""},
+		)
+	default:
+		frontends = append(frontends,
+			rimeFrontend{"fcitx5", filepath.Join(home, ".local", "share", "fcitx5", "rime"), fcitx5DeployCmd},
+			rimeFrontend{"ibus", filepath.Join(home, ".config", "ibus", "rime"), ibusDeployCmd},
+			rimeFrontend{"fcitx4", filepath.Join(home, ".config", "fcitx", "rime"), fcitx4DeployCmd},
+		)
+	}
+	return frontends
+}
+
+// 查找当前系统中已存在用户目录的Rime前端，都不存在时返回默认的前端
+func detectRimeFrontends() []rimeFrontend {
+	home, _ := os.UserHomeDir()
+	configDir, _ := os.UserConfigDir()
+	candidates := rimeFrontendCandidates(runtime.GOOS, home, configDir, os.Getenv("RIME_USER_DIR"))
+	found := make([]rimeFrontend, 0)
+	for _, f := range candidates {
+		if stat, err := os.Stat(f.Dir); err == nil && stat.IsDir() {
+			found = append(found, f)
+		}
+	}
+	if len(found) == 0 {
+		// 环境变量指向的目录不存在时，仍使用系统默认的前端
+		for _, f := range candidates {
+			if f.Name != "custom" {
+				return []rimeFrontend{f}
+			}
+		}
+	}
+	return found
+}
+
+// 小狼毫最新版本的部署命令，未安装时为空
+func weaselDeployCmd() string {
+	dirEntries, err := os.ReadDir("C:\\PROGRA~2\\Rime")
+	var maxVersion string
+	if err == nil && len(dirEntries) > 0 {
+		for _, dir := range dirEntries {
+			if dir.IsDir() && strings.HasPrefix(dir.Name(), "weasel") {
+				dirName := dir.Name()
+				if compareVersion(dirName, maxVersion) {
+					maxVersion = dirName
+				}
+			}
+		}
+	}
+	if maxVersion == "" {
+		return ""
+	}
+	return filepath.Join("C:\\PROGRA~2\\Rime", maxVersion, "WeaselDeployer.exe") + " /deploy"
+}
+
+// 将s格式化为YAML的字符串，命令中可能有引号与反斜杠
+func yamlString(s string) string {
+	if s == "" {
+		return ""
+	}
+	return strconv.Quote(s)
+}
+
+// 找到多个前端时，让用户选择要使用的前端，直接回车或输入无效时使用第一个
+func chooseFrontend(frontends []rimeFrontend, in io.Reader, out io.Writer) rimeFrontend {
+	if len(frontends) == 1 {
+		return frontends[0]
+	}
+	fmt.Fprintln(out, "找到多个Rime前端，每个前端都将作为profile写入配置文件，可通过Ctrl+R切换:")
+	for i, f := range frontends {
+		fmt.Fprintf(out, "  %d. %s (%s)\n", i+1, f.Name, f.Dir)
+	}
+	fmt.Fprint(out, "请选择要使用的前端[1]: ")
+	line, _ := bufio.NewReader(in).ReadString('\n')
+	i, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || i < 1 || i > len(frontends) {
+		i = 1
+	}
+	return frontends[i-1]
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MapoMagpie/rimedm/dict"
+)
+
+// git_repo 未配置时，使用第一个主词典所在的目录(一般为Rime的用户目录)
+func gitRepoPath(opts *Options) string {
+	if opts.GitRepo != "" {
+		return absPath(opts.GitRepo)
+	}
+	if len(opts.DictPaths) > 0 {
+		return filepath.Dir(absPath(opts.DictPaths[0]))
+	}
+	return ""
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func git(repo string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// path相对于仓库的路径，不在仓库中时返回false
+func repoRel(repo, path string) (string, bool) {
+	rel, err := filepath.Rel(repo, absPath(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// 变更记录中的文件路径相对于仓库，以便仓库移动后仍可还原
+func relPath(repo, path string) string {
+	if rel, ok := repoRel(repo, path); ok {
+		return filepath.ToSlash(rel)
+	}
+	return absPath(path)
+}
+
+func commitMessage(repo string, changes []dict.Change) string {
+	counts := make(map[dict.ChangeType]int)
+	lines := make([]string, 0, len(changes))
+	for _, c := range changes {
+		counts[c.Type]++
+		c.FilePath = relPath(repo, c.FilePath)
+		lines = append(lines, c.String())
+	}
+	summary := fmt.Sprintf("rimedm: 新增 %d 项，修改 %d 项，删除 %d 项", counts[dict.CHANGE_ADD], counts[dict.CHANGE_MOD], counts[dict.CHANGE_DEL])
+	if n := counts[dict.CHANGE_MOVE]; n > 0 {
+		summary += fmt.Sprintf("，移动 %d 项", n)
+	}
+	return summary + "\n\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// 将变更的码表文件提交到git仓库，仓库不存在时自动初始化
+func gitCommit(repo string, changes []dict.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	files := make([]string, 0)
+	for _, c := range changes {
+		if !slices.Contains(files, c.FilePath) {
+			files = append(files, c.FilePath)
+		}
+	}
+	return gitCommitFiles(repo, files, commitMessage(repo, changes))
+}
+
+// 以message提交files，仓库不存在时自动初始化；跳过不在仓库中的文件
+func gitCommitFiles(repo string, files []string, message string) error {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		rel, ok := repoRel(repo, file)
+		if !ok {
+			slog.Warn("file is outside the git repo, skip committing", "file", file, "repo", repo)
+			continue
+		}
+		paths = append(paths, rel)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	if _, err := git(repo, "rev-parse", "--is-inside-work-tree"); err != nil {
+		if _, err := git(repo, "init"); err != nil {
+			return err
+		}
+	}
+	if _, err := git(repo, append([]string{"add", "--"}, paths...)...); err != nil {
+		return err
+	}
+	_, err := git(repo, append([]string{"commit", "-m", message, "--"}, paths...)...)
+	return err
+}
+
+// 一次提交中关于某项的变更
+type historyItem struct {
+	hash   string
+	date   string
+	change dict.Change // FilePath 为绝对路径
+}
+
+func (h historyItem) String() string {
+	c := h.change
+	c.FilePath = filepath.Base(c.FilePath)
+	return h.date + " " + h.hash + " " + c.String()
+}
+
+// 查找提交历史中关于 字词+编码 的变更，按提交时间从新到旧排列
+func gitHistory(repo, text, code string) ([]historyItem, error) {
+	if _, err := git(repo, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return nil, errors.New("未找到git仓库: " + repo)
+	}
+	out, err := git(repo, "log", "-n", "500", "--fixed-strings", "--grep="+text,
+		"--date=format:%Y-%m-%d %H:%M", "--format=%h%x1f%ad%x1f%B%x1e")
+	if err != nil {
+		return nil, err
+	}
+	items := make([]historyItem, 0)
+	for commit := range strings.SplitSeq(out, "\x1e") {
+		fields := strings.SplitN(strings.TrimLeft(commit, "\n"), "\x1f", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		for line := range strings.SplitSeq(fields[2], "\n") {
+			c, ok := dict.ParseChange(line)
+			if !ok || !c.Mentions(text, code) {
+				continue
+			}
+			if !filepath.IsAbs(c.FilePath) {
+				c.FilePath = filepath.Join(repo, filepath.FromSlash(c.FilePath))
+			}
+			items = append(items, historyItem{hash: fields[0], date: fields[1], change: c})
+		}
+	}
+	return items, nil
+}
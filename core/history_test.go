@@ -0,0 +1,62 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MapoMagpie/rimedm/dict"
+)
+
+func Test_gitCommit_relativePath(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	for _, key := range []string{"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(key, "rimedm")
+	}
+	repo := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "b.dict.yaml")
+	for _, path := range []string{filepath.Join(repo, "a.dict.yaml"), outside} {
+		if err := os.WriteFile(path, []byte("你好\tnau\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 以相对于工作目录(而非仓库)的路径指定的词典，不在仓库中的文件被跳过
+	work := filepath.Join(repo, "work")
+	if err := os.Mkdir(work, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(work)
+	changes := []dict.Change{
+		{Type: dict.CHANGE_ADD, FilePath: "../a.dict.yaml", Raw: "你好\tnau"},
+		{Type: dict.CHANGE_ADD, FilePath: outside, Raw: "你好\tnau"},
+	}
+	if err := gitCommit(repo, changes); err != nil {
+		t.Fatalf("gitCommit() error = %v", err)
+	}
+	files, err := git(repo, "ls-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(files) != "a.dict.yaml" {
+		t.Errorf("committed files = %q", files)
+	}
+}
+
+func Test_commitMessage(t *testing.T) {
+	repo := t.TempDir()
+	path := filepath.Join(repo, "a.dict.yaml")
+	changes := []dict.Change{
+		{Type: dict.CHANGE_MOD, FilePath: path, Old: "你好\tnau", Raw: "你好\tnh"},
+		{Type: dict.CHANGE_MOVE, FilePath: path, Raw: "啊\ta"},
+	}
+	want := "rimedm: 新增 0 项，修改 1 项，删除 0 项，移动 1 项\n\n" +
+		"MOD a.dict.yaml | 你好\tnau => 你好\tnh\n" +
+		"MOVE a.dict.yaml | 啊\ta\n"
+	if got := commitMessage(repo, changes); got != want {
+		t.Errorf("commitMessage() = %q, want %q", got, want)
+	}
+}
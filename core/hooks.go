@@ -0,0 +1,143 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MapoMagpie/rimedm/dict"
+	"github.com/MapoMagpie/rimedm/tui"
+	mutil "github.com/MapoMagpie/rimedm/util"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Hooks 是在写入文件、部署、添加项时执行的命令，通过环境变量获取变更的文件与项：
+//
+//	RIMEDM_HOOK     钩子名称，如 post_flush
+//	RIMEDM_CONFIG   配置文件路径
+//	RIMEDM_FILES    变更的文件，每行一个
+//	RIMEDM_CHANGES  变更的项，每行一项，格式同git提交信息: 类型 文件 | 内容
+//	RIMEDM_COUNT    变更的项数
+type Hooks struct {
+	PreFlush   string `yaml:"pre_flush"`   // 写入文件前，有未写入的变更时执行
+	PostFlush  string `yaml:"post_flush"`  // 写入文件后、提交git与部署前执行
+	PostDeploy string `yaml:"post_deploy"` // 部署成功后执行，变更为本次部署包含的所有变更
+	OnAdd      string `yaml:"on_add"`      // 在Tui中添加项后执行
+}
+
+const (
+	HOOK_PRE_FLUSH   = "pre_flush"
+	HOOK_POST_FLUSH  = "post_flush"
+	HOOK_POST_DEPLOY = "post_deploy"
+	HOOK_ON_ADD      = "on_add"
+)
+
+var hookTimeout = 30 * time.Second
+
+// 执行钩子命令，命令为空时不执行；失败时返回包含钩子名称与命令输出的错误
+func runHook(name, command, configPath string, changes []dict.Change) error {
+	if command == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := mutil.RunContext(ctx, command)
+	cmd.Env = append(os.Environ(), hookEnv(name, configPath, changes)...)
+	cmd.WaitDelay = time.Second
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		slog.Debug("hook output", "hook", name, "output", string(out))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("超时(%v)", hookTimeout)
+	} else if err != nil {
+		if msg := lastLine(string(out)); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+	}
+	if err != nil {
+		slog.Error("hook failed", "hook", name, "cmd", command, "err", err)
+		return fmt.Errorf("钩子%s执行失败: %w", name, err)
+	}
+	slog.Info("hook", "hook", name, "changes", len(changes), "elapsed", time.Since(start))
+	return nil
+}
+
+// 描述变更的环境变量
+func hookEnv(name, configPath string, changes []dict.Change) []string {
+	files := make([]string, 0)
+	lines := make([]string, 0, len(changes))
+	for _, c := range changes {
+		if !slices.Contains(files, c.FilePath) {
+			files = append(files, c.FilePath)
+		}
+		lines = append(lines, c.String())
+	}
+	return []string{
+		"RIMEDM_HOOK=" + name,
+		"RIMEDM_CONFIG=" + configPath,
+		"RIMEDM_FILES=" + strings.Join(files, "\n"),
+		"RIMEDM_CHANGES=" + strings.Join(lines, "\n"),
+		"RIMEDM_COUNT=" + strconv.Itoa(len(changes)),
+	}
+}
+
+// 写入文件，并在前后执行pre_flush与post_flush钩子，钩子失败时通知用户，不影响写入。
+// 钩子修改了码表文件(如格式化)时重新读取，修改的文件中有未写入的修改时不写入此文件，以免覆盖钩子的修改
+func flushWithHooks(opts *Options, dc *dict.Dictionary) ([]dict.Change, error) {
+	if opts.Hooks.PreFlush != "" {
+		if pending := dc.Pending(); len(pending) > 0 {
+			if err := runHook(HOOK_PRE_FLUSH, opts.Hooks.PreFlush, opts.ConfigPath, pending); err != nil {
+				notifyUser(err.Error())
+			}
+			reloadAfterHook(HOOK_PRE_FLUSH, dc)
+		}
+	}
+	changes, err := dc.Flush()
+	if len(changes) > 0 && opts.Hooks.PostFlush != "" {
+		if err := runHook(HOOK_POST_FLUSH, opts.Hooks.PostFlush, opts.ConfigPath, changes); err != nil {
+			notifyUser(err.Error())
+		}
+		reloadAfterHook(HOOK_POST_FLUSH, dc)
+	}
+	return changes, err
+}
+
+// 重新读取被钩子修改的码表文件，通知Tui关闭编辑表单并重新搜索，以免修改已被替换的项
+func reloadAfterHook(name string, dc *dict.Dictionary) {
+	reloaded, err := dc.Reload()
+	if err != nil {
+		slog.Error("reload dictionary failed", "hook", name, "err", err)
+		notifyUser("重新读取文件失败: " + err.Error())
+	}
+	if len(reloaded) == 0 {
+		return
+	}
+	slog.Info("reload files modified by hook", "hook", name, "files", reloaded)
+	names := make([]string, len(reloaded))
+	for i, path := range reloaded {
+		names[i] = filepath.Base(path)
+	}
+	notifyReloaded(fmt.Sprintf("钩子%s修改了 %s，已重新读取", name, strings.Join(names, ", ")))
+}
+
+// 在后台执行on_add钩子，失败时在Tui中通知
+func onAddHook(opts *Options, added dict.Change) tea.Cmd {
+	if opts.Hooks.OnAdd == "" {
+		return nil
+	}
+	return func() tea.Msg {
+		if err := runHook(HOOK_ON_ADD, opts.Hooks.OnAdd, opts.ConfigPath, []dict.Change{added}); err != nil {
+			return tui.NotifitionMsg(err.Error())
+		}
+		return nil
+	}
+}
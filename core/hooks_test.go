@@ -0,0 +1,140 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MapoMagpie/rimedm/dict"
+)
+
+func Test_flushWithHooks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.dict.yaml")
+	if err := os.WriteFile(path, []byte("---\nname: a\n...\n你好\tnau\t1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := dict.Open([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := dc.Find("你好", "")[0]
+	if err := dc.Update(entry, func(data *dict.Data) { data.Weight = 5 }); err != nil {
+		t.Fatal(err)
+	}
+	// 钩子将环境变量与当时文件的内容追加到日志中
+	logPath := filepath.Join(dir, "hooks.log")
+	hook := `{ echo "$RIMEDM_HOOK $RIMEDM_COUNT $RIMEDM_FILES"; echo "$RIMEDM_CHANGES"; tail -n 1 "$RIMEDM_FILES"; } >> ` + logPath
+	opts := &Options{ConfigPath: "config.yaml", Hooks: Hooks{PreFlush: hook, PostFlush: hook}}
+	changes, err := flushWithHooks(opts, dc)
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("flushWithHooks() = %v, %v", changes, err)
+	}
+	bs, _ := os.ReadFile(logPath)
+	want := strings.Join([]string{
+		"pre_flush 1 " + path,
+		"MOD " + path + " | 你好\tnau\t1 => 你好\tnau\t5",
+		"你好\tnau\t1", // 写入文件前
+		"post_flush 1 " + path,
+		"MOD " + path + " | 你好\tnau\t1 => 你好\tnau\t5",
+		"你好\tnau\t5", // 写入文件后
+	}, "\n") + "\n"
+	if string(bs) != want {
+		t.Errorf("hooks log = %q, want %q", bs, want)
+	}
+
+	// 没有变更时不执行钩子
+	if err := os.Remove(logPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := flushWithHooks(opts, dc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Errorf("hooks should not run without changes")
+	}
+}
+
+// post_flush钩子修改了码表文件时重新读取，之后的写入不覆盖钩子的修改
+func Test_flushWithHooks_reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.dict.yaml")
+	if err := os.WriteFile(path, []byte("---\nname: a\n...\n你好\tnau\t1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := dict.Open([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := make([]string, 0)
+	setNotifier(func(msg string) { msgs = append(msgs, msg) })
+	defer setNotifier(nil)
+	opts := &Options{Hooks: Hooks{PostFlush: `printf '再见\tzj\t1\n' >> "$RIMEDM_FILES"`}}
+	if err := dc.Update(dc.Find("你好", "")[0], func(data *dict.Data) { data.Weight = 5 }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := flushWithHooks(opts, dc); err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0] != "钩子post_flush修改了 a.dict.yaml，已重新读取" {
+		t.Errorf("notifications = %q", msgs)
+	}
+	entries := dc.Find("再见", "")
+	if len(entries) != 1 {
+		t.Fatalf("entry added by hook not reloaded")
+	}
+	opts.Hooks.PostFlush = ""
+	if err := dc.Update(entries[0], func(data *dict.Data) { data.Weight = 2 }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := flushWithHooks(opts, dc); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := os.ReadFile(path); string(bs) != "---\nname: a\n...\n你好\tnau\t5\n再见\tzj\t2\n" {
+		t.Errorf("file = %q", bs)
+	}
+}
+
+func Test_runHook_failure(t *testing.T) {
+	err := runHook(HOOK_POST_FLUSH, "echo 格式化失败 >&2; exit 3", "", nil)
+	if err == nil || err.Error() != "钩子post_flush执行失败: exit status 3: 格式化失败" {
+		t.Errorf("runHook() error = %v", err)
+	}
+	if err := runHook(HOOK_POST_FLUSH, "", "", nil); err != nil {
+		t.Errorf("runHook() with empty command error = %v", err)
+	}
+}
+
+func Test_deployer_postDeploy(t *testing.T) {
+	dir := t.TempDir()
+	var mu sync.Mutex
+	msgs := make([]string, 0)
+	d := newDeployer()
+	setNotifier(func(msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		msgs = append(msgs, msg)
+	})
+	defer setNotifier(nil)
+	d.SetPostDeploy(`echo "$RIMEDM_COUNT" > `+filepath.Join(dir, "count"), "")
+	d.SetCommand("echo ok")
+	changes := []dict.Change{
+		{Type: dict.CHANGE_ADD, FilePath: "a.dict.yaml", Raw: "你好\tnau"},
+		{Type: dict.CHANGE_DEL, FilePath: "a.dict.yaml", Raw: "再见\tzj"},
+	}
+	d.Deploy(changes...)
+	d.Wait()
+	if bs, _ := os.ReadFile(filepath.Join(dir, "count")); string(bs) != "2\n" {
+		t.Errorf("post_deploy RIMEDM_COUNT = %q", bs)
+	}
+
+	d.SetPostDeploy("exit 1", "")
+	d.Deploy(changes...)
+	d.Wait()
+	if len(msgs) != 3 || msgs[2] != "钩子post_deploy执行失败: exit status 1" {
+		t.Errorf("msgs = %q", msgs)
+	}
+}
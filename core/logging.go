@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	logMaxSize = 5 << 20 // 日志文件超过此大小时轮转
+	logBackups = 3       // 轮转时保留的旧日志文件数: debug.log.1 ~ debug.log.3
+)
+
+// SetupLogging 将日志按log_level写入log_file(默认为配置目录下的debug.log)，返回的Closer用于退出时关闭日志文件
+func SetupLogging(opts *Options) (io.Closer, error) {
+	if !validLogLevel(opts.LogLevel) {
+		return nil, fmt.Errorf("日志级别的有效值为 debug|info|warn|error: %s", opts.LogLevel)
+	}
+	var level slog.Level // 默认为info
+	_ = level.UnmarshalText([]byte(opts.LogLevel))
+	path := opts.LogFile
+	if path == "" {
+		path = filepath.Join(filepath.Dir(opts.ConfigPath), "debug.log")
+	}
+	f, err := openRotateFile(path, logMaxSize, logBackups)
+	if err != nil {
+		return nil, fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	// 标准库log的输出也将经由此处写入日志文件
+	slog.SetDefault(slog.New(slog.NewTextHandler(f, &slog.HandlerOptions{Level: level})))
+	return f, nil
+}
+
+// 检查日志级别，为空时使用默认的info
+func validLogLevel(level string) bool {
+	var l slog.Level
+	return level == "" || l.UnmarshalText([]byte(level)) == nil
+}
+
+// 按大小轮转的日志文件，写入后超过maxSize时，path重命名为path.1，原有的path.1重命名为path.2，依此类推，最多保留backups个
+type rotateFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+func openRotateFile(path string, maxSize int64, backups int) (*rotateFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	r := &rotateFile{path: path, maxSize: maxSize, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	// 上次运行留下的日志已超过大小时，先轮转
+	if r.size >= maxSize {
+		if err := r.rotate(); err != nil {
+			_ = r.file.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *rotateFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.file, r.size = f, stat.Size()
+	return nil
+}
+
+// 重命名失败时继续写入原文件，只有无法重新打开文件时返回错误
+func (r *rotateFile) rotate() error {
+	_ = r.file.Close()
+	if r.backups > 0 {
+		for i := r.backups - 1; i > 0; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		_ = os.Rename(r.path, r.path+".1")
+	} else {
+		_ = os.Remove(r.path)
+	}
+	return r.open()
+}
+
+func (r *rotateFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotateFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_rotateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "debug.log")
+	// 上次运行留下的日志已超过大小，打开时轮转
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 10)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openRotateFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		path:        "eeee\n",
+		path + ".1": "cccc\ndddd\n",
+		path + ".2": "aaaa\nbbbb\n",
+	}
+	for p, content := range want {
+		if bs, _ := os.ReadFile(p); string(bs) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(p), bs, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("only %d backups should be kept", 2)
+	}
+}
+
+func Test_validLogLevel(t *testing.T) {
+	for level, want := range map[string]bool{"": true, "debug": true, "INFO": true, "warn": true, "error": true, "verbose": false} {
+		if got := validLogLevel(level); got != want {
+			t.Errorf("validLogLevel(%q) = %v, want %v", level, got, want)
+		}
+	}
+}
@@ -4,16 +4,19 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
-	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/MapoMagpie/rimedm/dict"
 	"github.com/goccy/go-yaml"
 	flags "github.com/spf13/pflag"
+	"golang.org/x/term"
 )
 
 var version = "1.1.6"
@@ -26,9 +29,56 @@ type Options struct {
 	Export         string   `yaml:"export"`
 	ExportColumns  string   `yaml:"export_columns"`
 	ExportWithSort bool     `yaml:"export_with_sort"`
+	WeightFloor    int      `yaml:"weight_floor"`
+	WeightCeiling  int      `yaml:"weight_ceiling"`
+	FrequencyPath  string   `yaml:"frequency_path"`
+	// 导入词频时，词频到权重的映射方式: linear|log|rank|raw
+	FrequencyMapping dict.FrequencyMapping `yaml:"frequency_mapping"`
+	// 每次同步到文件后，将变更的码表文件提交到git仓库
+	GitHistory bool   `yaml:"git_history"`
+	GitRepo    string `yaml:"git_repo"`
+	// 添加、修改时检查编码能否被方案输入: block|warn|off
+	CodeCheck string `yaml:"code_check"`
+	// 删除、对整个文件批量调整权重前需要确认
+	Confirm bool `yaml:"confirm"`
+	// 只读文件，可以搜索但不能修改，支持通配符
+	ReadonlyPaths []string `yaml:"readonly_paths"`
+	// 命名的配置组，如不同的方案、前端，profile中的配置项覆盖以上的同名配置项
+	Profiles map[string]any `yaml:"profiles"`
+	// 默认使用的profile，可通过 --profile 指定
+	Profile string `yaml:"profile"`
+	// 写入文件、部署、添加项时执行的命令
+	Hooks Hooks `yaml:"hooks"`
+	// 日志文件，默认为配置目录下的debug.log，超过5MB时轮转
+	LogFile string `yaml:"log_file"`
+	// 日志级别: debug|info|warn|error，可通过 --log-level 指定
+	LogLevel string `yaml:"log_level"`
+	// 以下仅来自命令行
+	ConfigPath string   `yaml:"-"`
+	Command    string   `yaml:"-"` // 子命令，为空时运行Tui
+	Args       []string `yaml:"-"` // 子命令的参数
+	JSON       bool     `yaml:"-"`
+	Output     string   `yaml:"-"`
+	Changelog  string   `yaml:"-"` // 退出时将本次会话的变更记录写入此文件
+	Force      bool     `yaml:"-"` // config init 时覆盖已存在的配置文件
+	NoSync     bool     `yaml:"-"` // 指定了 -s false，切换profile后保持
 }
 
-func ParseOptions() (Options, string) {
+// 可用的子命令
+var commands = []string{"stats", "lint", "apply", "fmt", "diff", "merge", "config"}
+
+// code_check 的有效值
+const (
+	CODE_CHECK_BLOCK = "block" // 不允许添加、修改
+	CODE_CHECK_WARN  = "warn"  // 仅提示
+	CODE_CHECK_OFF   = "off"   // 不检查
+)
+
+// 直接以参数指定码表文件，无需加载dict_paths的子命令
+var fileCommands = []string{"diff", "merge"}
+
+// ParseOptions 解析命令行参数与配置文件，返回的错误属于用法或配置的错误
+func ParseOptions() (Options, string, error) {
 	configDir, _ := os.UserConfigDir()
 	defaultConfigPath := filepath.Join(configDir, "rimedm", "config.yaml")
 
@@ -37,6 +87,7 @@ func ParseOptions() (Options, string) {
 	dictPaths := flags.StringArrayP("dict", "d", []string{}, "(当使用配置文件时可选)主词典文件(方案名.dict.yaml)路径，通过主词典会自动加载其他拓展词典，无需指定拓展词典。\n支持多个主词典文件，\ne.g: rimedm -d ./xkjd6.dict.yaml -d ./xhup.dict.txt")
 
 	userPath := flags.StringP("user", "u", "", "用户词典路径，此选项的作用是在加词时默认首选")
+	profile := flags.StringP("profile", "p", "", "使用配置文件中profiles下的某个配置组，如不同的方案、前端，可在Tui中通过Ctrl+R切换(切换后不保留-d、-u、--cmd)")
 
 	syncOnChange := flags.BoolP("sync", "s", true, "是否在每次添加、删除、修改时立即同步到词典文件")
 	restartRimeCmd := flags.String("cmd", "", "同步到词典文件后，用于重新部署rime的命令，使更改即时生效，不同的系统环境下需要不同的命令")
@@ -45,6 +96,13 @@ func ParseOptions() (Options, string) {
 	exportColumns := flags.String("cols", "text,code,weight", "依赖-e参数，导出码表时，导出列(text:字词,code:编码,weight:权重)的顺序。")
 	exportWithSort := flags.Bool("sort", false, "依赖-e参数，导出码表时，将根据权重重新排序。有些输入法(fcitx5-chinese-addons)没有权重设计，依靠字词在文件中的顺序来决定候选顺序。如果当前码表也没有权重，那么将保持不变。")
 
+	jsonOutput := flags.Bool("json", false, "依赖stats命令，以JSON格式输出。")
+	output := flags.StringP("output", "o", "", "依赖merge命令，合并结果写入此文件，若不指定，将输出到标准输出流中。")
+	force := flags.Bool("force", false, "依赖config init命令，覆盖已存在的配置文件(原文件备份为.bak)。")
+	changelog := flags.String("changelog", "", "退出时将本次写入码表的变更记录写入此文件，可通过 rimedm apply 应用到其他码表；以.json结尾时输出JSON。")
+
+	logLevel := flags.String("log-level", "", "日志级别(debug|info|warn|error)，默认为info，覆盖配置文件中的log_level。")
+
 	showVersion := flags.BoolP("version", "v", false, "显示版本号，在此检查最新版本 https://github.com/MapoMagpie/rimedm")
 
 	flags.Usage = func() {
@@ -53,6 +111,21 @@ func ParseOptions() (Options, string) {
   按下确认键可选择将输入内容加入码表，或是在搜索结果中选择要修改、删除的项。
   注：1. 加词时输入的内容顺序随意，只要以空格隔开即可; 2. 不会破坏码表原本的样式，如注释、配置
 
+用法：
+  rimedm [选项]         运行Tui
+  rimedm stats [选项]   输出词典的统计数据(项数、编码长度分布、重码率等)
+  rimedm lint           检查编码不符合方案(字母表、最大码长)与重复的项，有问题时以非零状态码退出
+  rimedm apply 变更文件  应用变更文件，每行为一项变更：+ 添加、- 删除、~ 修改列(如 weight=20)、> 移动(如 file=user)，
+                        任意一行失败时不写入任何修改
+  rimedm fmt [code|text] 格式化所有可写的码表：按编码(或字词)排序，以单个制表符分隔各列，
+                        去除行尾的空白与重复项，保留头部与注释，注释或空行之间的项分别排序
+  rimedm diff A B       比较两个码表文件，以 字词+编码 作为项的标识，列出新增(+)、删除(-)、修改(~)的项
+  rimedm merge base ours theirs [-o 输出文件]
+                        三方合并码表文件，将theirs相对base的变更合并到ours中，保留ours的头部与注释
+  rimedm config check   检查配置文件：未知的配置项、不存在的词典、不在词典中的user_path，并执行部署命令
+  rimedm config init [--force]
+                        生成配置文件，--force 时覆盖已存在的配置文件
+
 选项：`)
 		flags.PrintDefaults()
 		fmt.Fprintln(os.Stderr, `
@@ -67,6 +140,23 @@ func ParseOptions() (Options, string) {
      rimedm -d rime/xkjd.dict.yaml -d table/mb.txt(支持所有以制表符分隔字码的码表)
   4. 禁用修改后 "立即同步码表"、"执行重新部属命令" ，但仍在退出时执行。当你的系统文件性能低，每次加词改词会卡顿时用此方法。
      rimedm -s false
+  5. 统计码表
+     rimedm stats
+     rimedm stats --json
+  6. 检查码表
+     rimedm lint
+  7. 批量应用变更，并记录本次修改以便分享给他人
+     rimedm apply changes.txt
+     rimedm --changelog my-changes.txt
+  8. 格式化码表(不带权重的码表按字词排序会改变编码相同的项的候选顺序)
+     rimedm fmt
+     rimedm fmt text
+  9. 合并上游码表的更新与本地的修改
+     rimedm diff xkjd6.cizu.old.dict.yaml xkjd6.cizu.dict.yaml
+     rimedm merge xkjd6.cizu.old.dict.yaml 本地/xkjd6.cizu.dict.yaml 上游/xkjd6.cizu.dict.yaml -o merged.dict.yaml
+  10. 检查配置文件，或重新生成配置文件
+     rimedm config check
+     rimedm config init --force
 			`)
 	}
 	flags.CommandLine.SortFlags = false
@@ -77,7 +167,29 @@ func ParseOptions() (Options, string) {
 	}
 
 	fixedConfigPath := fixPath(*configPath)
-	opts := parseFromFile(fixedConfigPath)
+	if args := flags.Args(); len(args) > 0 && args[0] == "config" {
+		// 检查、生成配置文件时不在此读取配置文件，日志仍写入配置目录
+		if err := os.MkdirAll(filepath.Dir(fixedConfigPath), os.ModePerm); err != nil {
+			return Options{}, fixedConfigPath, fmt.Errorf("创建配置目录失败: %w", err)
+		}
+		if !validLogLevel(*logLevel) {
+			return Options{}, fixedConfigPath, errors.New("参数--log-level的有效值为 debug|info|warn|error")
+		}
+		return Options{Command: args[0], Args: args[1:], ConfigPath: fixedConfigPath, Force: *force, LogLevel: *logLevel}, fixedConfigPath, nil
+	}
+	opts, err := parseFromFile(fixedConfigPath)
+	if err != nil {
+		return opts, fixedConfigPath, err
+	}
+	if *profile != "" {
+		opts.Profile = *profile
+	}
+	if opts.Profile != "" {
+		if opts, err = applyProfile(opts, opts.Profile); err != nil {
+			return opts, fixedConfigPath, err
+		}
+	}
+	opts.ConfigPath = fixedConfigPath
 
 	if len(*dictPaths) > 0 {
 		opts.DictPaths = *dictPaths
@@ -100,7 +212,7 @@ func ParseOptions() (Options, string) {
 			case "code":
 			case "weight":
 			default:
-				panic("参数--cols的有效值为text|code|weight，以逗号分隔")
+				return opts, fixedConfigPath, errors.New("参数--cols的有效值为text|code|weight，以逗号分隔")
 			}
 		}
 		opts.ExportColumns = *exportColumns
@@ -110,61 +222,145 @@ func ParseOptions() (Options, string) {
 	}
 	if syncOnChange != nil && !*syncOnChange {
 		opts.SyncOnChange = false
+		opts.NoSync = true
 	}
+	if args := flags.Args(); len(args) > 0 {
+		if !slices.Contains(commands, args[0]) {
+			return opts, fixedConfigPath, fmt.Errorf("未知的命令: %s，可用的命令: %s", args[0], strings.Join(commands, ", "))
+		}
+		opts.Command = args[0]
+		opts.Args = args[1:]
+	}
+	opts.JSON = *jsonOutput
+	opts.Output = *output
+	opts.Changelog = *changelog
+	if *logLevel != "" {
+		opts.LogLevel = *logLevel
+	}
+	err = opts.normalize()
+	return opts, fixedConfigPath, err
+}
 
-	if len(opts.DictPaths) == 0 {
-		panic(fmt.Sprintf("未指定词典文件，请检查配置文件[%s]或通过 -d 指定词典文件\n", fixedConfigPath))
+// 检查配置项并修正路径
+func (opts *Options) normalize() error {
+	if !slices.Contains([]string{CODE_CHECK_BLOCK, CODE_CHECK_WARN, CODE_CHECK_OFF}, opts.CodeCheck) {
+		return fmt.Errorf("配置项code_check的有效值为 %s|%s|%s", CODE_CHECK_BLOCK, CODE_CHECK_WARN, CODE_CHECK_OFF)
+	}
+	if len(opts.DictPaths) == 0 && !slices.Contains(fileCommands, opts.Command) {
+		return fmt.Errorf("未指定词典文件，请检查配置文件[%s]或通过 -d 指定词典文件", opts.ConfigPath)
+	}
+	if !validLogLevel(opts.LogLevel) {
+		return fmt.Errorf("配置项log_level的有效值为 debug|info|warn|error")
 	}
 
+	opts.DictPaths = slices.Clone(opts.DictPaths)
+	opts.ReadonlyPaths = slices.Clone(opts.ReadonlyPaths)
 	for i := range opts.DictPaths {
 		opts.DictPaths[i] = fixPath(opts.DictPaths[i])
 	}
 	opts.UserPath = fixPath(opts.UserPath)
-	return opts, fixedConfigPath
+	opts.FrequencyPath = fixPath(opts.FrequencyPath)
+	opts.GitRepo = fixPath(opts.GitRepo)
+	opts.LogFile = fixPath(opts.LogFile)
+	for i := range opts.ReadonlyPaths {
+		opts.ReadonlyPaths[i] = fixPath(opts.ReadonlyPaths[i])
+	}
+	return nil
 }
 
-func initConfigFile(filePath string) {
-	dirPath := filepath.Dir(filePath)
-	_, err := os.OpenFile(dirPath, os.O_RDONLY, 0666)
+// 将名为name的profile中的配置项覆盖到opts上
+func applyProfile(opts Options, name string) (Options, error) {
+	profile, ok := opts.Profiles[name]
+	if !ok {
+		return opts, fmt.Errorf("未知的profile: %s，可用的profile: %s", name, strings.Join(profileNames(&opts), ", "))
+	}
+	bs, err := yaml.Marshal(profile)
+	if err == nil {
+		err = yaml.Unmarshal(bs, &opts)
+	}
 	if err != nil {
-		if os.IsNotExist(err) {
-			err = os.MkdirAll(dirPath, os.ModePerm)
-			if err != nil {
-				panic(fmt.Sprintf("mkdir [%s] err : %s", dirPath, err))
-			}
-		} else {
-			panic(fmt.Sprintf("open [%s] err : %s", dirPath, err))
-		}
+		return opts, fmt.Errorf("解析profile[%s]失败: %w", name, err)
+	}
+	opts.Profile = name
+	return opts, nil
+}
+
+// 按名称排序的所有profile
+func profileNames(opts *Options) []string {
+	return slices.Sorted(maps.Keys(opts.Profiles))
+}
+
+// 重新读取配置文件并切换到名为name的profile，保留仅来自命令行的选项
+func switchProfile(curr *Options, name string) (*Options, error) {
+	opts, err := parseFromFile(curr.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if opts, err = applyProfile(opts, name); err != nil {
+		return nil, err
+	}
+	opts.ConfigPath = curr.ConfigPath
+	opts.Changelog = curr.Changelog
+	if curr.NoSync {
+		opts.SyncOnChange, opts.NoSync = false, true
+	}
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+	return &opts, nil
+}
+
+func initConfigFile(filePath string) error {
+	dirPath := filepath.Dir(filePath)
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("创建配置目录失败: %w", err)
 	}
 	file, err := os.Create(filePath)
 	if err != nil {
-		panic(fmt.Sprintf("create [%s] err : %s", filePath, err))
+		return fmt.Errorf("创建配置文件失败: %w", err)
 	}
 	defer func() {
 		_ = file.Close()
 	}()
-	_, err = file.WriteString(initConfigTemplate())
-	if err != nil {
-		panic(fmt.Sprintf("write [%s] err : %s", filePath, err))
+	frontends := detectRimeFrontends()
+	chosen := frontends[0]
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		chosen = chooseFrontend(frontends, os.Stdin, os.Stderr)
 	}
+	if _, err = file.WriteString(initConfigTemplate(chosen, frontends)); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	return nil
 }
 
-func initConfigTemplate() string {
-	dicts, restartRimeCmd := osRimeDefaultValue()
-
-	sb := strings.Builder{}
-	dedup := make(map[string]bool, 0)
-	for i, dict := range dicts {
-		if _, ok := dedup[dict]; ok {
-			continue
+// 生成配置文件，使用chosen的主词典与部署命令，找到多个前端时每个前端生成一个profile
+func initConfigTemplate(chosen rimeFrontend, frontends []rimeFrontend) string {
+	// 方案的主词典，只启用第一个
+	dictList := func(dir, indent string, commentOthers bool) string {
+		sb := strings.Builder{}
+		dedup := make(map[string]bool, 0)
+		for i, dict := range findRimeDicts(dir) {
+			if _, ok := dedup[dict]; ok {
+				continue
+			}
+			dedup[dict] = true
+			if i > 0 && commentOthers {
+				sb.WriteString("#")
+			}
+			sb.WriteString(indent + "  - ")
+			sb.WriteString(dict)
+			sb.WriteString("\n")
 		}
-		dedup[dict] = true
-		if i > 0 {
-			sb.WriteString("#")
+		return sb.String()
+	}
+	profiles := ""
+	if len(frontends) > 1 {
+		sb := strings.Builder{}
+		sb.WriteString("\n\n# 找到的所有Rime前端\nprofiles:\n")
+		for _, f := range frontends {
+			fmt.Fprintf(&sb, "  %s:\n    dict_paths:\n%s    restart_rime_cmd: %s\n", f.Name, dictList(f.Dir, "    ", true), yamlString(f.DeployCmd))
 		}
-		sb.WriteString("  - ")
-		sb.WriteString(dict)
-		sb.WriteString("\n")
+		profiles = strings.TrimSuffix(sb.String(), "\n")
 	}
 	return fmt.Sprintf(`# Rime Dict Manager config file
 # This file is generated by rime-dict-manager.
@@ -203,83 +399,106 @@ sync_on_change: true
 #   注:PROGRA~2 = Program Files (x86) PROGRA~1 = Program Files
 # 在MacOS   + 鼠须管 下可通过此命令来重启 rime: 
 #   /Library/Input Methods/Squirrel.app/Contents/MacOS/Squirrel --reload
-
-restart_rime_cmd: %s`, sb.String(), restartRimeCmd)
-}
-
-func osRimeDefaultValue() (dicts []string, restartRimeCmd string) {
-	configDir, err := os.UserConfigDir()
-	if err != nil {
-		return []string{}, ""
-	}
-	switch runtime.GOOS {
-	case "windows":
-		// find rime install path
-		dirEntries, err := os.ReadDir("C:\\PROGRA~2\\Rime")
-		var maxVersion string
-		if err == nil && len(dirEntries) > 0 {
-			for _, dir := range dirEntries {
-				if dir.IsDir() && strings.HasPrefix(dir.Name(), "weasel") {
-					dirName := dir.Name()
-					if compareVersion(dirName, maxVersion) {
-						maxVersion = dirName
-					}
-				} else {
-					continue
-				}
-			}
-		}
-		dicts = findRimeDicts(filepath.Join(configDir, "rime"))
-		if maxVersion != "" {
-			restartRimeCmd = filepath.Join("C:\\PROGRA~2\\Rime", maxVersion, "WeaselDeployer.exe") + " /deploy"
-		}
-	case "dwain":
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return []string{}, ""
-		}
-		dicts = findRimeDicts(filepath.Join(homeDir, "Library", "Rime"))
-		restartRimeCmd = "\"/Library/Input Methods/Squirrel.app/Contents/MacOS/Squirrel\" --reload" // mabye
-	default:
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return []string{}, ""
-		}
-		dicts = findRimeDicts(filepath.Join(homeDir, ".local/share/fcitx5/rime"))
-		restartRimeCmd = "dbus-send --session --print-reply --dest=org.fcitx.Fcitx5 /controller org.fcitx.Fcitx.Controller1.SetConfig string:'fcitx://config/addon/rime' variant:string:''"
-	}
-	return
+# 在Linux + IBus 下: ibus restart
+# 在Linux + Fcitx4 下: fcitx-remote -r
+# 同文输入法(Trime)需在应用中手动部署，此项留空
+
+restart_rime_cmd: %s
+
+# 权重工具(Ctrl+W)的参数
+# weight_floor:      权重下限，默认为 1
+# weight_ceiling:    权重上限，按词频缩放权重时，词频最高的字词将获得此权重
+# frequency_path:    词频表路径，每行为 字词<TAB>词频
+# frequency_mapping: 导入词频时，词频到权重的映射方式，默认为 linear
+#   linear: 线性缩放到[weight_floor, weight_ceiling]
+#   log:    取对数后缩放到[weight_floor, weight_ceiling]
+#   rank:   按词频排名，词频最低的为1
+#   raw:    直接使用词频作为权重
+# 词频表中未匹配的字词，可按码表的造词规则(encoder/rules)生成编码后添加到指定的文件中
+
+# weight_floor: 1
+# weight_ceiling: 10000
+# frequency_path: 
+# frequency_mapping: linear
+
+# 是否在每次同步到词典文件后，将变更的码表文件提交到git仓库，提交信息中列出了新增、修改、删除的项
+# 可通过Ctrl+G浏览当前项的变更历史，并还原其中的某次变更
+# git_repo: git仓库的路径，默认为第一个主词典所在的目录(一般为Rime的用户目录)，仓库不存在时将自动初始化
+
+# git_history: false
+# git_repo: 
+
+# 添加、修改时，检查编码能否被使用此码表的方案输入(方案的speller/alphabet与speller/max_code_length)
+# 方案为码表所在目录中 translator/dictionary 指向此码表的 *.schema.yaml，同时应用 *.custom.yaml 中的补丁
+#   block: 编码不符合时不允许添加、修改(默认)
+#   warn:  仅提示
+#   off:   不检查
+# 可通过 rimedm lint 检查码表中已有的项
+
+# code_check: block
+
+# 删除、对整个文件批量调整权重前是否需要确认，默认为 true
+# confirm: true
+
+# 只读文件的路径，支持通配符，如方案自带、会被方案更新覆盖的词典
+# 只读文件可以搜索，但不会被修改与写入；修改其中的项时，修改后的项将添加到用户词典(user_path)中
+# 删除不会转到用户词典，只读文件中的项不能删除
+# readonly_paths:
+#   - 词典文件路径
+#   - $HOME/.local/share/fcitx5/rime/*.extended.dict.yaml
+
+# 命名的配置组，如在形码与拼音方案、fcitx5与ibus之间切换，profile中的配置项覆盖以上的同名配置项
+# 通过 rimedm --profile 名称 使用，或在Tui中通过Ctrl+R切换(将写入修改后重新加载词典)
+# 切换后词典、用户词典与部署命令以新profile的配置为准，不保留命令行中的 -d、-u、--cmd
+# profile: 默认使用的profile
+# profiles:
+#   xkjd:
+#     dict_paths:
+#       - $HOME/.local/share/fcitx5/rime/xkjd6.dict.yaml
+#   pinyin:
+#     dict_paths:
+#       - $HOME/.config/ibus/rime/rime_ice.dict.yaml
+#     user_path: $HOME/.config/ibus/rime/rime_ice.user.dict.yaml
+#     restart_rime_cmd: ibus-daemon -drx
+
+# 钩子：在写入文件、部署、添加项时执行的命令，失败时在Tui中提示
+# 命令可通过环境变量获取变更：RIMEDM_HOOK(钩子名称)、RIMEDM_CONFIG(配置文件)、RIMEDM_FILES(变更的文件，每行一个)、
+#   RIMEDM_CHANGES(变更的项，每行一项，如 ADD 文件 | 你好	nau	1)、RIMEDM_COUNT(变更的项数)
+# pre_flush:   写入文件前，有未写入的变更时执行
+# post_flush:  写入文件后、部署前执行，如复制到同步目录
+# post_deploy: 部署成功后执行，如 notify-send "Rime已部署 $RIMEDM_COUNT 项"
+# on_add:      在Tui中添加项后执行
+# 钩子修改了码表文件(如格式化、排序)时将重新读取；pre_flush修改了有未写入修改的文件时，为避免覆盖钩子的修改，此文件不再写入，需重新打开本程序
+# hooks:
+#   post_flush: cp $RIMEDM_FILES ~/Sync/rime/
+#   post_deploy: notify-send rimedm "已部署 $RIMEDM_COUNT 项变更"
+
+# 日志文件与日志级别，日志文件超过5MB时轮转，保留3个旧日志(debug.log.1 ~ debug.log.3)
+# log_file: 默认为配置目录下的debug.log
+# log_level: debug|info|warn|error，默认为 info，debug时记录每一项的增删改
+#   只在启动时生效，profile中的这两项将被忽略
+
+# log_file: 
+# log_level: info%s`, dictList(chosen.Dir, "", true), yamlString(chosen.DeployCmd), profiles)
 }
 
-func parseFromFile(path string) Options {
+func parseFromFile(path string) (Options, error) {
 	path = fixPath(path)
-	file, err := os.Open(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			initConfigFile(path)
-			file, err = os.Open(path)
-			if err != nil {
-				panic(fmt.Sprintf("init config file [%s] err : %s", path, err))
-			}
-		} else {
-			panic(fmt.Sprintf("open [%s] err : %s", path, err))
+	opts := Options{WeightFloor: 1, FrequencyMapping: dict.FREQ_LINEAR, CodeCheck: CODE_CHECK_BLOCK, Confirm: true}
+	bs, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if err = initConfigFile(path); err != nil {
+			return opts, err
 		}
+		bs, err = os.ReadFile(path)
 	}
-	defer func() {
-		_ = file.Close()
-	}()
-	stat, err := file.Stat()
 	if err != nil {
-		panic(fmt.Sprintf("file stat [%s] err : %s", path, err))
+		return opts, fmt.Errorf("读取配置文件失败: %w", err)
 	}
-	bs := make([]byte, stat.Size())
-	_, _ = file.Read(bs)
-	var opts Options
-	err = yaml.Unmarshal(bs, &opts)
-	if err != nil {
-		panic(fmt.Sprintf("parse config [%s] err : %s", path, err))
+	if err = yaml.Unmarshal(bs, &opts); err != nil {
+		return opts, fmt.Errorf("解析配置文件[%s]失败: %w", path, err)
 	}
-	return opts
+	return opts, nil
 }
 
 func findRimeDicts(rimeConfigDir string) []string {
@@ -328,7 +547,7 @@ func findRimeDicts(rimeConfigDir string) []string {
 		schemaPath := fixPath(filepath.Join(rimeConfigDir, schema))
 		schemaFile, err := os.Open(schemaPath)
 		if err != nil {
-			log.Println("cannot find schema: ", schemaPath)
+			slog.Warn("cannot find schema", "path", schemaPath)
 			continue
 		}
 		defer func(ff *os.File) {
@@ -365,10 +584,10 @@ func findRimeDicts(rimeConfigDir string) []string {
 					dictPrefix := strings.TrimSpace(line[i+len("dictionary: ") : end])
 					dictPath := fixPath(filepath.Join(rimeConfigDir, dictPrefix+".dict.yaml"))
 					if _, err := os.Stat(dictPath); errors.Is(err, os.ErrNotExist) {
-						log.Println("cannot find dict: ", dictPath)
+						slog.Warn("cannot find dict", "path", dictPath)
 						continue
 					} else {
-						log.Println("find dict:", dictPath, "; schema:", schema)
+						slog.Debug("find dict", "path", dictPath, "schema", schema)
 					}
 					// check dict file exist
 					dicts = append(dicts, dictPath)
@@ -384,11 +603,9 @@ func findRimeDicts(rimeConfigDir string) []string {
 func fixPath(path string) string {
 	newPath := path
 	if strings.HasPrefix(path, "~") {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			panic(err)
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			newPath = homeDir + (path)[1:]
 		}
-		newPath = homeDir + (path)[1:]
 	}
 	return os.ExpandEnv(newPath)
 }
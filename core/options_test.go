@@ -1,10 +1,14 @@
 package core
 
 import (
+	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
+
+	"github.com/goccy/go-yaml"
 )
 
 func Test_compareMaxVersion(t *testing.T) {
@@ -100,3 +104,119 @@ func Test_findRimeDicts(t *testing.T) {
 		})
 	}
 }
+
+func Test_switchProfile(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	config := `dict_paths:
+  - /rime/xkjd6.dict.yaml
+restart_rime_cmd: fcitx5-remote -r
+sync_on_change: true
+weight_floor: 5
+profiles:
+  pinyin:
+    dict_paths:
+      - /rime/pinyin.dict.yaml
+    user_path: /rime/pinyin_user.dict.yaml
+  ibus:
+    restart_rime_cmd: ibus restart
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	curr := &Options{ConfigPath: configPath, Changelog: "changes.txt"}
+	opts, err := switchProfile(curr, "pinyin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(opts.DictPaths, []string{"/rime/pinyin.dict.yaml"}) || opts.UserPath != "/rime/pinyin_user.dict.yaml" ||
+		opts.RestartRimeCmd != "fcitx5-remote -r" || opts.WeightFloor != 5 || opts.Profile != "pinyin" || opts.Changelog != "changes.txt" {
+		t.Errorf("switchProfile(pinyin) = %+v", opts)
+	}
+	if opts, err = switchProfile(curr, "ibus"); err != nil || opts.RestartRimeCmd != "ibus restart" || opts.DictPaths[0] != "/rime/xkjd6.dict.yaml" {
+		t.Errorf("switchProfile(ibus) = %+v, %v", opts, err)
+	}
+	// 命令行中的 -s false 在切换后保持
+	if opts, err = switchProfile(&Options{ConfigPath: configPath, NoSync: true}, "pinyin"); err != nil || opts.SyncOnChange || !opts.NoSync {
+		t.Errorf("switchProfile() with -s false = %+v, %v", opts, err)
+	}
+	if opts, err = switchProfile(curr, "pinyin"); err != nil || !opts.SyncOnChange {
+		t.Errorf("switchProfile() sync_on_change = %+v, %v", opts, err)
+	}
+	if _, err := switchProfile(curr, "wubi"); err == nil || !strings.Contains(err.Error(), "ibus, pinyin") {
+		t.Errorf("switchProfile(wubi) error = %v", err)
+	}
+}
+
+func Test_rimeFrontendCandidates(t *testing.T) {
+	names := func(frontends []rimeFrontend) []string {
+		ret := make([]string, 0, len(frontends))
+		for _, f := range frontends {
+			ret = append(ret, f.Name)
+		}
+		return ret
+	}
+	tests := []struct {
+		goos    string
+		userDir string
+		want    []string
+	}{
+		{"linux", "", []string{"fcitx5", "ibus", "fcitx4"}},
+		{"linux", "/rime", []string{"custom", "fcitx5", "ibus", "fcitx4"}},
+		{"darwin", "", []string{"squirrel"}},
+		{"windows", "", []string{"weasel"}},
+		{"android", "", []string{"trime", "trime-termux"}},
+	}
+	for _, tt := range tests {
+		got := rimeFrontendCandidates(tt.goos, "/home/u", "/home/u/.config", tt.userDir)
+		if !reflect.DeepEqual(names(got), tt.want) {
+			t.Errorf("rimeFrontendCandidates(%s, %q) = %v, want %v", tt.goos, tt.userDir, names(got), tt.want)
+		}
+	}
+	if got := rimeFrontendCandidates("linux", "/home/u", "", ""); got[1].Dir != filepath.Join("/home/u", ".config", "ibus", "rime") || got[1].DeployCmd != "ibus restart" {
+		t.Errorf("ibus = %+v", got[1])
+	}
+}
+
+func Test_initConfigTemplate(t *testing.T) {
+	dir := t.TempDir()
+	frontends := make([]rimeFrontend, 0)
+	for _, name := range []string{"fcitx5", "ibus"} {
+		rimeDir := filepath.Join(dir, name)
+		if err := os.MkdirAll(rimeDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]string{
+			"default.yaml":        "schema_list:\n  - schema: " + name + "\n",
+			name + ".schema.yaml": "translator:\n  dictionary: " + name + "\n",
+			name + ".dict.yaml":   "---\nname: " + name + "\n...\n",
+		}
+		for file, content := range files {
+			if err := os.WriteFile(filepath.Join(rimeDir, file), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		frontends = append(frontends, rimeFrontend{name, rimeDir, name + " restart"})
+	}
+	frontends[0].DeployCmd = squirrelDeployCmd // 含引号的命令
+
+	out := strings.Builder{}
+	chosen := chooseFrontend(frontends, strings.NewReader("2\n"), &out)
+	if chosen.Name != "ibus" || !strings.Contains(out.String(), "2. ibus") {
+		t.Errorf("chooseFrontend() = %v, output %q", chosen, out.String())
+	}
+	var opts Options
+	if err := yaml.Unmarshal([]byte(initConfigTemplate(chosen, frontends)), &opts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(opts.DictPaths, []string{filepath.Join(dir, "ibus", "ibus.dict.yaml")}) || opts.RestartRimeCmd != "ibus restart" {
+		t.Errorf("initConfigTemplate() dict_paths = %v, restart_rime_cmd = %q", opts.DictPaths, opts.RestartRimeCmd)
+	}
+	fcitx5, err := applyProfile(opts, "fcitx5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fcitx5.DictPaths, []string{filepath.Join(dir, "fcitx5", "fcitx5.dict.yaml")}) || fcitx5.RestartRimeCmd != squirrelDeployCmd {
+		t.Errorf("profile fcitx5 dict_paths = %v, restart_rime_cmd = %q", fcitx5.DictPaths, fcitx5.RestartRimeCmd)
+	}
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/MapoMagpie/rimedm/dict"
+)
+
+// 将统计数据格式化为多行文本，用于终端输出与Tui显示
+func statsLines(s dict.Stats) []string {
+	lines := make([]string, 0)
+	summary := func(s dict.Stats, indent string) {
+		lines = append(lines,
+			fmt.Sprintf("%s项数: %d (单字: %d, 词组: %d, 扩展区汉字: %d, 无权重: %d)", indent, s.Entries, s.SingleChars, s.Phrases, s.ExtendedCJK, s.NoWeight),
+			fmt.Sprintf("%s编码数: %d, 重码数: %d, 重码率: %.2f%%, 最多候选: %d (%s)", indent, s.Codes, s.DuplicateCodes, s.DuplicateRate*100, s.MaxCandidates, s.MaxCandidatesCode),
+		)
+	}
+	lines = append(lines, "所有词典:")
+	summary(s, "  ")
+	lengths := make([]int, 0, len(s.CodeLengths))
+	for l := range s.CodeLengths {
+		lengths = append(lengths, l)
+	}
+	slices.Sort(lengths)
+	lines = append(lines, "  编码长度分布:")
+	for _, l := range lengths {
+		count := s.CodeLengths[l]
+		lines = append(lines, fmt.Sprintf("    %2d码: %d (%.2f%%)", l, count, float64(count)/float64(max(s.Entries, 1))*100))
+	}
+	for _, fs := range s.Files {
+		lines = append(lines, filepath.Base(fs.FilePath)+":")
+		summary(fs, "  ")
+	}
+	return lines
+}
+
+// 输出统计数据到w
+func printStats(w io.Writer, s dict.Stats, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(s)
+	}
+	for _, line := range statsLines(s) {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 输出码表中的问题到w，未找到方案的主词典提示到info，有问题时返回错误
+func printLint(w, info io.Writer, dc *dict.Dictionary) error {
+	for fe := range dc.Files() {
+		if fe.CodeRule == nil {
+			fmt.Fprintf(info, "%s: 未找到使用此码表的方案，跳过编码检查\n", fe.FilePath)
+		}
+	}
+	issues := dc.Lint()
+	for _, issue := range issues {
+		if _, err := fmt.Fprintln(w, issue); err != nil {
+			return err
+		}
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("发现 %d 个问题", len(issues))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package dict
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"maps"
+	"slices"
+	"sort"
+)
+
+// OpenOptions 是 Open 的选项，零值即为默认选项
+type OpenOptions struct {
+	// 搜索使用的匹配器，为nil时使用 CacheMatcher
+	Matcher Matcher
+	// 为true时，加载中的警告(如 ErrColumnAmbiguous)也作为错误返回
+	Strict bool
+	// 只读文件的路径，支持通配符，见 SetReadonly
+	ReadonlyPaths []string
+}
+
+// Open 加载码表文件及其引用的拓展词典，文件按参数的顺序排列，拓展词典在其主词典之后。
+// 返回的 Dictionary 可在多个goroutine中使用，修改后通过 Save 写回文件
+func Open(paths []string, opts *OpenOptions) (*Dictionary, error) {
+	if opts == nil {
+		opts = &OpenOptions{}
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("未指定码表文件")
+	}
+	fes, err := LoadItems(paths...)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(fes, func(i, j int) bool {
+		return fes[j].Cmp(fes[i])
+	})
+	if err := SetReadonly(fes, opts.ReadonlyPaths); err != nil {
+		return nil, err
+	}
+	dc := NewDictionary(fes, opts.Matcher)
+	if warnings := dc.Warnings(); opts.Strict && len(warnings) > 0 {
+		return nil, errors.Join(warnings...)
+	}
+	return dc, nil
+}
+
+// Warnings 返回加载时所有文件的警告
+func (d *Dictionary) Warnings() []error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	warnings := make([]error, 0)
+	for _, fe := range d.fileEntries {
+		warnings = append(warnings, fe.Warnings...)
+	}
+	return warnings
+}
+
+// Files 遍历已加载的文件
+func (d *Dictionary) Files() iter.Seq[*FileEntries] {
+	d.mu.RLock()
+	fes := slices.Clone(d.fileEntries)
+	d.mu.RUnlock()
+	return slices.Values(fes)
+}
+
+// All 遍历所有未删除的项，遍历的是调用时的快照，遍历中可以修改或删除项
+func (d *Dictionary) All() iter.Seq[*Entry] {
+	entries := d.Entries()
+	return func(yield func(*Entry) bool) {
+		for _, entry := range entries {
+			if entry.IsDelete() {
+				continue
+			}
+			if !yield(entry) {
+				return
+			}
+		}
+	}
+}
+
+// Find 查找字词与编码完全相同的未删除项，text或code为空时不限制此列
+func (d *Dictionary) Find(text, code string) []*Entry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ret := make([]*Entry, 0)
+	for _, entry := range d.entries {
+		if entry.IsDelete() {
+			continue
+		}
+		if (text == "" || entry.data.Text == text) && (code == "" || entry.data.Code == code) {
+			ret = append(ret, entry)
+		}
+	}
+	return ret
+}
+
+// Update 通过fn修改entry的数据，修改后按其所在文件的列序重新生成内容
+func (d *Dictionary) Update(entry *Entry, fn func(data *Data)) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if entry.IsDelete() {
+		return ErrEntryDeleted
+	}
+	if entry.stale {
+		return ErrStale
+	}
+	fe := d.fileOf(entry)
+	if fe == nil {
+		return ErrFileNotLoaded
+	}
+	if fe.Readonly {
+		return ErrReadonly
+	}
+	data := entry.data
+	data.Extra = maps.Clone(data.Extra)
+	fn(&data)
+	data.ResetColumns(&fe.Columns)
+	entry.ReRaw(data.ToString())
+	return nil
+}
+
+// Insert 将data按fe的列序添加到fe中，返回新增的项
+func (d *Dictionary) Insert(fe *FileEntries, data Data) (*Entry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !slices.Contains(d.fileEntries, fe) {
+		return nil, ErrFileNotLoaded
+	}
+	if fe.Readonly {
+		return nil, ErrReadonly
+	}
+	data.ResetColumns(&fe.Columns)
+	raw := data.ToString()
+	entry := NewEntryAdd(raw, fe.ID, fastParseData(raw, &fe.Columns))
+	d.add(entry)
+	return entry, nil
+}
+
+// Save 将变更写入文件，返回此次写入的变更。
+// ctx取消后不再开始写入其余的文件，未写入的变更保留在内存中，可再次调用Save
+func (d *Dictionary) Save(ctx context.Context) ([]Change, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.output(ctx)
+}
@@ -0,0 +1,119 @@
+package dict
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChangelogItem 是本次会话中写入文件的一项变更
+type ChangelogItem struct {
+	Time   time.Time  `json:"time"`
+	Type   ChangeType `json:"type"`
+	File   string     `json:"file"`
+	Before string     `json:"before,omitempty"` // 修改前或删除前的内容
+	After  string     `json:"after,omitempty"`  // 新增或修改后的内容
+	cols   []Column
+}
+
+// 写入文件并将写入的变更记录到变更记录中
+func (d *Dictionary) output(ctx context.Context) ([]Change, error) {
+	changes, err := output(ctx, d.fileEntries)
+	now := time.Now()
+	for _, c := range changes {
+		if c.Type == CHANGE_MOVE { // 无法在变更文件中表示
+			continue
+		}
+		item := ChangelogItem{Time: now, Type: c.Type, File: c.FilePath}
+		switch c.Type {
+		case CHANGE_ADD:
+			item.After = c.Raw
+		case CHANGE_MOD:
+			item.Before, item.After = c.Old, c.Raw
+		case CHANGE_DEL:
+			item.Before = c.Raw
+		}
+		if i := slices.IndexFunc(d.fileEntries, func(fe *FileEntries) bool { return fe.FilePath == c.FilePath }); i != -1 {
+			item.cols = slices.Clone(d.fileEntries[i].Columns)
+		}
+		d.changelog = append(d.changelog, item)
+	}
+	return changes, err
+}
+
+// Changelog 返回本次会话中写入文件的所有变更
+func (d *Dictionary) Changelog() []ChangelogItem {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return slices.Clone(d.changelog)
+}
+
+// PatchLine 将变更格式化为变更文件中的一行，可通过 ParsePatch 解析并应用到其他词典
+func (c ChangelogItem) PatchLine() string {
+	file := " file=" + quoteValue(filepath.Base(c.File))
+	switch c.Type {
+	case CHANGE_ADD:
+		after := fastParseData(c.After, &c.cols)
+		return "+ " + patchSpec(&after, c.cols) + patchArgs(nil, &after, c.cols) + file
+	case CHANGE_MOD:
+		before, after := fastParseData(c.Before, &c.cols), fastParseData(c.After, &c.cols)
+		return "~ " + patchSpec(&before, c.cols) + patchArgs(&before, &after, c.cols) + file
+	default:
+		before := fastParseData(c.Before, &c.cols)
+		return "- " + patchSpec(&before, c.cols) + file
+	}
+}
+
+// 字词、编码与权重(码表有权重列时)，用于定位项
+func patchSpec(data *Data, cols []Column) string {
+	spec := data.Text + "\t" + data.Code
+	if slices.Contains(cols, COLUMN_WEIGHT) {
+		spec += "\t" + strconv.Itoa(data.Weight)
+	}
+	return spec
+}
+
+// 与before不同的列，before为nil时为字词、编码、权重以外非空的列，值包含空白时以双引号包围
+func patchArgs(before, after *Data, cols []Column) string {
+	sb := strings.Builder{}
+	for _, col := range cols {
+		value := after.Get(col)
+		if before == nil {
+			if value == "" || col == COLUMN_TEXT || col == COLUMN_CODE || col == COLUMN_WEIGHT {
+				continue
+			}
+		} else if before.Get(col) == value {
+			continue
+		}
+		name := string(col)
+		if !col.IsExtra() {
+			name = strings.ToLower(name)
+		}
+		sb.WriteString(" " + name + "=" + quoteValue(value))
+	}
+	return sb.String()
+}
+
+// WriteChangelog 将变更记录写入w，默认为变更文件的格式(每项前有一行记录时间与文件的注释)，asJSON时为JSON数组
+func WriteChangelog(w io.Writer, items []ChangelogItem, asJSON bool) error {
+	if asJSON {
+		if items == nil {
+			items = []ChangelogItem{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(items)
+	}
+	for _, item := range items {
+		if _, err := fmt.Fprintf(w, "# %s %s\n%s\n", item.Time.Format(time.DateTime), item.File, item.PatchLine()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package dict
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Dictionary_Changelog(t *testing.T) {
+	content := "---\nname: a\ncolumns: [text, code, weight, comment]\n...\n你好\tnau\t1\t问候\n再见\tzj\t1\n"
+	local, upstream := t.TempDir(), t.TempDir()
+	writeFiles(t, local, map[string]string{"a.dict.yaml": content})
+	writeFiles(t, upstream, map[string]string{"a.dict.yaml": content})
+	dc, err := Open([]string{filepath.Join(local, "a.dict.yaml")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe := dc.fileEntries[0]
+	if _, err := dc.Insert(fe, Data{Text: "good night", Code: "gn", Weight: 2, Extra: map[Column]string{"comment": "晚安 bye"}}); err != nil {
+		t.Fatal(err)
+	}
+	entries := dc.Find("", "")
+	if err := dc.Update(entries[0], func(data *Data) { data.Weight = 5; data.Extra["comment"] = "say \"hi\" 打招呼" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Delete(entries[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.Buffer{}
+	if err := WriteChangelog(&buf, dc.Changelog(), false); err != nil {
+		t.Fatal(err)
+	}
+	lines := make([]string, 0)
+	for line := range strings.SplitSeq(strings.TrimSpace(buf.String()), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	want := []string{
+		"+ good night\tgn\t2 comment=\"晚安 bye\" file=a.dict.yaml",
+		"~ 你好\tnau\t1 weight=5 comment=\"say \\\"hi\\\" 打招呼\" file=a.dict.yaml",
+		"- 再见\tzj\t1 file=a.dict.yaml",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("WriteChangelog() = %q, want %q", lines, want)
+	}
+
+	// 变更记录可应用到另一份码表上
+	other, err := Open([]string{filepath.Join(upstream, "a.dict.yaml")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := ParsePatch(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.ApplyPatch(ops, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := os.ReadFile(filepath.Join(local, "a.dict.yaml"))
+	b, _ := os.ReadFile(filepath.Join(upstream, "a.dict.yaml"))
+	if string(a) != string(b) {
+		t.Errorf("applied changelog = %q, want %q", b, a)
+	}
+
+	buf.Reset()
+	if err := WriteChangelog(&buf, dc.Changelog(), true); err != nil {
+		t.Fatal(err)
+	}
+	var items []ChangelogItem
+	if err := json.Unmarshal(buf.Bytes(), &items); err != nil || len(items) != 3 || items[1].Before != "你好\tnau\t1\t问候" {
+		t.Errorf("WriteChangelog() json = %s, %v", buf.String(), err)
+	}
+}
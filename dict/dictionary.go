@@ -4,19 +4,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/MapoMagpie/rimedm/util"
 )
 
+// Dictionary 可被多个goroutine同时使用：搜索、预览等只读操作持有读锁，
+// 添加、删除、修改、批量调整与写入文件持有写锁。
+// 对项的修改需通过Dictionary的方法(如ReRaw、Delete)进行，不要直接调用Entry的方法
 type Dictionary struct {
+	mu          sync.RWMutex
 	matcher     Matcher
 	entries     []*Entry
 	fileEntries []*FileEntries
+	history     []*Batch
+	changelog   []ChangelogItem
 }
 
 func NewDictionary(fes []*FileEntries, matcher Matcher) *Dictionary {
@@ -34,38 +44,111 @@ func NewDictionary(fes []*FileEntries, matcher Matcher) *Dictionary {
 	}
 }
 
+// Entries 返回所有项的快照
 func (d *Dictionary) Entries() []*Entry {
-	return d.entries
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return slices.Clone(d.entries)
 }
 
+// FileEntries 返回fe中所有项的快照，写入文件时会对fe.Entries重新排序，因此不要直接遍历fe.Entries
+func (d *Dictionary) FileEntries(fe *FileEntries) []*Entry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return slices.Clone(fe.Entries)
+}
+
+// Search 搜索key并将结果分批发送到resultChan。在读锁内复制要匹配的内容，匹配与发送时不持有锁，
+// 接收方阻塞时不会阻塞写入文件等需要写锁的操作
 func (d *Dictionary) Search(key string, useColumn Column, searchVersion int, resultChan chan<- MatchResultChunk, ctx context.Context) {
 	// log.Printf("search key: %s, version: %d", string(key), searchVersion)
+	d.mu.RLock()
+	items := make([]SearchItem, 0, len(d.entries))
+	for _, entry := range d.entries {
+		if entry.IsDelete() {
+			continue
+		}
+		item := SearchItem{Entry: entry}
+		if len(key) > 0 {
+			item.Target = searchTarget(entry, useColumn)
+		}
+		items = append(items, item)
+	}
+	d.mu.RUnlock()
 	if len(key) == 0 {
-		done := false
-		go func() {
-			<-ctx.Done()
-			done = true
-		}()
-		list := d.Entries()
-		ret := make([]*MatchResult, len(list))
-		deleteCount := 0 // for ret (len = list), if skip deleted, shrink ret
-		for i, entry := range list {
-			if done {
+		ret := make([]*MatchResult, len(items))
+		for i, item := range items {
+			if ctx.Err() != nil {
 				return
 			}
-			if entry.IsDelete() {
-				deleteCount += 1
-				continue
-			}
-			ret[i-deleteCount] = &MatchResult{Entry: entry}
+			ret[i] = &MatchResult{Entry: item.Entry}
 		}
-		resultChan <- MatchResultChunk{Result: ret[0 : len(ret)-deleteCount], Version: searchVersion}
+		sendResult(ctx, resultChan, MatchResultChunk{Result: ret, Version: searchVersion})
 	} else {
-		d.matcher.Search(key, useColumn, searchVersion, d.Entries(), resultChan, ctx)
+		d.matcher.Search(key, useColumn, searchVersion, items, resultChan, ctx)
 	}
 }
 
-func (d *Dictionary) Add(entry *Entry) {
+// Candidates 列出编码与code完全相同的所有项，并按照Rime码表翻译器的方式排序：
+// 权重高的在前，权重相同时按文件顺序(词典加载顺序，文件中的行序，尚未保存的新增项在该文件末尾)
+func (d *Dictionary) Candidates(code string) []*MatchResult {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	fileOrder := d.fileOrder()
+	ret := make([]*MatchResult, 0)
+	for _, entry := range d.entries {
+		if entry.IsDelete() || entry.data.Code != code {
+			continue
+		}
+		ret = append(ret, &MatchResult{Entry: entry})
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return candidateLess(ret[i].Entry, ret[j].Entry, fileOrder)
+	})
+	return ret
+}
+
+// 词典的加载顺序，FID -> 序号
+func (d *Dictionary) fileOrder() map[uint8]int {
+	fileOrder := make(map[uint8]int, len(d.fileEntries))
+	for i, fe := range d.fileEntries {
+		fileOrder[fe.ID] = i
+	}
+	return fileOrder
+}
+
+// 编码相同的两项在Rime中的先后顺序
+func candidateLess(a, b *Entry, fileOrder map[uint8]int) bool {
+	ma, mb := &MatchResult{Entry: a}, &MatchResult{Entry: b}
+	if ma.Cmp(mb) || mb.Cmp(ma) { // 编码相同，Cmp只会比较权重
+		return ma.Cmp(mb)
+	}
+	if a.FID != b.FID {
+		return fileOrder[a.FID] < fileOrder[b.FID]
+	}
+	return physicalLess(a, b)
+}
+
+// 同一文件中两项的行序，尚未保存的新增项在文件末尾
+func physicalLess(a, b *Entry) bool {
+	aAdd, bAdd := a.modType == ADD, b.modType == ADD
+	if aAdd || bAdd {
+		return !aAdd && bAdd
+	}
+	return a.seek < b.seek
+}
+
+func (d *Dictionary) Add(entry *Entry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.readonly(entry) {
+		return ErrReadonly
+	}
+	d.add(entry)
+	return nil
+}
+
+func (d *Dictionary) add(entry *Entry) {
 	for _, fe := range d.fileEntries {
 		if fe.ID == entry.FID {
 			fe.Entries = append(fe.Entries, entry)
@@ -74,8 +157,47 @@ func (d *Dictionary) Add(entry *Entry) {
 	d.entries = append(d.entries, entry)
 }
 
-func (d *Dictionary) Delete(entry *Entry) {
+func (d *Dictionary) Delete(entry *Entry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.checkWritable(entry); err != nil {
+		return err
+	}
 	entry.Delete()
+	return nil
+}
+
+// ReRaw 修改entry的内容
+func (d *Dictionary) ReRaw(entry *Entry, raw string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.checkWritable(entry); err != nil {
+		return err
+	}
+	entry.ReRaw(raw)
+	return nil
+}
+
+// entry是否属于只读文件
+func (d *Dictionary) readonly(entry *Entry) bool {
+	fe := d.fileOf(entry)
+	return fe != nil && fe.Readonly
+}
+
+// 检查entry能否修改：已被重新读取的项替换时返回 ErrStale，属于只读文件时返回 ErrReadonly
+func (d *Dictionary) checkWritable(entry *Entry) error {
+	if entry.stale {
+		return ErrStale
+	}
+	if d.readonly(entry) {
+		return ErrReadonly
+	}
+	return nil
+}
+
+// 过滤掉只读文件中的项与已被重新读取的项替换的项
+func (d *Dictionary) writable(entries []*Entry) []*Entry {
+	return slices.DeleteFunc(slices.Clone(entries), func(e *Entry) bool { return d.checkWritable(e) != nil })
 }
 
 func (d *Dictionary) ResetMatcher() {
@@ -83,21 +205,60 @@ func (d *Dictionary) ResetMatcher() {
 }
 
 func (d *Dictionary) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	return len(d.entries)
 }
 
-func (d *Dictionary) Flush() (changed bool) {
+// Flush 将变更写入文件，返回此次写入的变更，以及写入失败的错误
+func (d *Dictionary) Flush() ([]Change, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	start := time.Now()
-	changed = output(d.fileEntries)
+	changes, err := d.output(context.Background())
 	since := time.Since(start)
-	if changed {
-		log.Printf("flush dictionary: %v\n", since)
+	if len(changes) > 0 {
+		slog.Info("flush dictionary", "changes", len(changes), "elapsed", since)
+	}
+	return changes, err
+}
+
+// Pending 返回尚未写入文件的变更，按文件顺序排列
+func (d *Dictionary) Pending() []Change {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	changes := make([]Change, 0)
+	for _, fe := range d.fileEntries {
+		if fe.Readonly {
+			continue
+		}
+		for _, entry := range fe.Entries {
+			change := Change{FilePath: fe.FilePath, Raw: entry.Raw()}
+			switch entry.modType {
+			case NC:
+				continue
+			case DELETE:
+				change.Type, change.Raw = CHANGE_DEL, entry.saved
+			case MODIFY:
+				modified, changed := entry.modifyChange()
+				if !changed {
+					continue
+				}
+				modified.FilePath = fe.FilePath
+				change = modified
+			case ADD:
+				change.Type = CHANGE_ADD
+			}
+			changes = append(changes, change)
+		}
 	}
-	return changed
+	return changes
 }
 
-func (d *Dictionary) ExportDict(path string, columns []Column, sortByWeight bool) {
-	exportDict(path, d.fileEntries, columns, sortByWeight)
+func (d *Dictionary) ExportDict(path string, columns []Column, sortByWeight bool) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return exportDict(path, d.fileEntries, columns, sortByWeight)
 }
 
 type ModifyType int
@@ -115,7 +276,11 @@ type Entry struct {
 	rawSize int64
 	modType ModifyType
 	raw     string
+	saved   string // 最近一次写入文件的内容
+	saves   int    // 写入文件的次数，撤销时据此判断修改是否已写入
+	moved   bool   // 所在的行被移动，尚未写入
 	deleted bool
+	stale   bool // 所在的文件已重新读取，此项已被新读取的项替换，不能再修改
 	data    Data
 }
 
@@ -148,6 +313,11 @@ func (e *Entry) Delete() {
 	e.modType = DELETE
 }
 
+// ModifyType 返回此项自上次写入文件后的变更类型
+func (e *Entry) ModifyType() ModifyType {
+	return e.modType
+}
+
 func (e *Entry) IsDelete() bool {
 	return e.deleted
 }
@@ -158,8 +328,22 @@ func (e *Entry) Raw() string {
 }
 
 func (e *Entry) Saved() {
+	e.saved = e.raw
 	e.rawSize = int64(len(e.raw)) + 1 // + 1 for '\n'
 	e.modType = NC
+	e.saves++
+	e.moved = false
+}
+
+// 修改的项写入时的变更(不包括文件路径)：内容没有变化时为只移动了所在的行，也没有移动(改回了原内容)时没有变更
+func (e *Entry) modifyChange() (Change, bool) {
+	switch {
+	case e.raw != e.saved:
+		return Change{Type: CHANGE_MOD, Raw: e.raw, Old: e.saved}, true
+	case e.moved:
+		return Change{Type: CHANGE_MOVE, Raw: e.raw}, true
+	}
+	return Change{}, false
 }
 
 // Parse input string to a pair of strings
@@ -247,7 +431,7 @@ func ParseData(pair []string, columns *[]Column) (Data, error) {
 		case COLUMN_STEM:
 			data.Stem = term
 		default:
-			continue
+			data.setExtra(col, term)
 		}
 	}
 	return data, nil
@@ -257,7 +441,8 @@ func fastParseData(raw string, cols *[]Column) Data {
 	split := strings.Split(raw, "\t")
 	colsLen := len(*cols)
 	data := Data{cols: cols}
-	for s, c := 0, 0; s < len(split) && c < colsLen; {
+	s, c := 0, 0
+	for s < len(split) && c < colsLen {
 		sp := split[s]
 		col := (*cols)[c]
 		c++
@@ -275,8 +460,13 @@ func fastParseData(raw string, cols *[]Column) Data {
 			data.Code = sp
 		case COLUMN_STEM:
 			data.Stem = sp
+		default:
+			data.setExtra(col, sp)
 		}
 	}
+	if s < len(split) { // 超出列声明的字段
+		data.Rest = strings.Join(split[s:], "\t")
+	}
 	return data
 }
 
@@ -289,6 +479,7 @@ func NewEntry(raw []byte, fileID uint8, seek int64, size int64, cols *[]Column)
 		seek:    seek,
 		rawSize: size,
 		raw:     str,
+		saved:   str,
 		data:    data,
 	}
 }
@@ -307,11 +498,29 @@ type Data struct {
 	Code   string
 	Stem   string
 	Weight int
-	cols   *[]Column
+	// 列声明中 text、code、weight、stem 以外的列，原样保留
+	Extra map[Column]string
+	// 超出列声明的字段，以制表符连接，原样保留
+	Rest string
+	cols *[]Column
+}
+
+func (d *Data) setExtra(col Column, value string) {
+	if d.Extra == nil {
+		d.Extra = make(map[Column]string)
+	}
+	d.Extra[col] = value
 }
 
 func (d *Data) ToString() string {
-	return d.ToStringWithColumns(d.cols)
+	return d.withRest(d.ToStringWithColumns(d.cols))
+}
+
+func (d *Data) withRest(raw string) string {
+	if d.Rest == "" {
+		return raw
+	}
+	return raw + "\t" + d.Rest
 }
 
 func (d *Data) ResetColumns(cols *[]Column) {
@@ -321,25 +530,49 @@ func (d *Data) ResetColumns(cols *[]Column) {
 func (d *Data) ToStringWithColumns(cols *[]Column) string {
 	sb := strings.Builder{}
 	for _, col := range *cols {
-		var b string
-		switch col {
-		case COLUMN_TEXT:
-			b = d.Text
-		case COLUMN_WEIGHT:
-			b = strconv.Itoa(d.Weight)
-		case COLUMN_CODE:
-			b = d.Code
-		case COLUMN_STEM:
-			b = d.Stem
-		}
 		if sb.Len() > 0 {
 			sb.WriteByte('\t')
 		}
-		sb.WriteString(b)
+		sb.WriteString(d.Get(col))
 	}
 	return sb.String()
 }
 
+// Get 返回列col的内容
+func (d *Data) Get(col Column) string {
+	switch col {
+	case COLUMN_TEXT:
+		return d.Text
+	case COLUMN_WEIGHT:
+		return strconv.Itoa(d.Weight)
+	case COLUMN_CODE:
+		return d.Code
+	case COLUMN_STEM:
+		return d.Stem
+	}
+	return d.Extra[col]
+}
+
+// Set 将列col设置为value，value需通过 Column.Check 的检查，权重为空时设置为0
+func (d *Data) Set(col Column, value string) error {
+	if err := col.Check(value); err != nil {
+		return err
+	}
+	switch col {
+	case COLUMN_TEXT:
+		d.Text = value
+	case COLUMN_WEIGHT:
+		d.Weight, _ = strconv.Atoi(value)
+	case COLUMN_CODE:
+		d.Code = value
+	case COLUMN_STEM:
+		d.Stem = value
+	default:
+		d.setExtra(col, value)
+	}
+	return nil
+}
+
 type Column string
 
 const (
@@ -349,4 +582,102 @@ const (
 	COLUMN_STEM   Column = "STEM"
 )
 
+// IsExtra 判断是否为 text、code、weight、stem 以外的列，这类列以码表中声明的列名表示
+func (c Column) IsExtra() bool {
+	switch c {
+	case COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT, COLUMN_STEM:
+		return false
+	}
+	return true
+}
+
+// Check 检查value能否作为此列的内容：字词与编码不能为空，权重为空或整数，造词码不能包含空白，所有列都不能包含制表符
+func (c Column) Check(value string) error {
+	if strings.ContainsAny(value, "\t\n") {
+		return errors.New("不能包含制表符或换行")
+	}
+	switch c {
+	case COLUMN_TEXT:
+		if strings.TrimSpace(value) == "" {
+			return errors.New("字词不能为空")
+		}
+	case COLUMN_CODE:
+		if strings.TrimSpace(value) == "" {
+			return errors.New("编码不能为空")
+		}
+	case COLUMN_WEIGHT:
+		if _, err := strconv.Atoi(value); value != "" && err != nil {
+			return errors.New("权重必须是整数")
+		}
+	case COLUMN_STEM:
+		if strings.ContainsFunc(value, unicode.IsSpace) {
+			return errors.New("造词码不能包含空白")
+		}
+	}
+	return nil
+}
+
+// ParseExtraInput 从输入中取出 列名=值 形式的其他列，值到空白为止，包含空白的值需用双引号包围，如 comment="很 常用"，
+// 返回其余的输入与其他列的值，只识别cols中的其他列
+func ParseExtraInput(raw string, cols []Column) (string, map[Column]string) {
+	var extra map[Column]string
+	rest := make([]string, 0)
+	for _, field := range splitFields(raw) {
+		if col := Column(field.name); field.arg && col.IsExtra() && slices.Contains(cols, col) {
+			if extra == nil {
+				extra = make(map[Column]string)
+			}
+			extra[col] = field.value
+			continue
+		}
+		rest = append(rest, raw[field.start:field.end])
+	}
+	return strings.Join(rest, " "), extra
+}
+
+// 输入中以空白分隔的字段，arg 表示 名称=值 形式的字段
+type inputField struct {
+	start, end  int // 在输入中的位置
+	arg         bool
+	name, value string // 值已去除引号
+}
+
+// 按空白切分输入，名称=值 中以双引号包围的值(Go的字符串格式)可以包含空白
+func splitFields(s string) []inputField {
+	fields := make([]inputField, 0)
+	spaceAt := func(i int) bool {
+		r, _ := utf8.DecodeRuneInString(s[i:])
+		return unicode.IsSpace(r)
+	}
+	for i := 0; i < len(s); {
+		if r, size := utf8.DecodeRuneInString(s[i:]); unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+		field := inputField{start: i, end: len(s)}
+		if end := strings.IndexFunc(s[i:], unicode.IsSpace); end != -1 {
+			field.end = i + end
+		}
+		if name, value, ok := strings.Cut(s[i:field.end], "="); ok && name != "" && !strings.Contains(name, `"`) {
+			field.arg, field.name, field.value = true, name, value
+			at := i + len(name) + 1
+			if quoted, err := strconv.QuotedPrefix(s[at:]); err == nil && (at+len(quoted) == len(s) || spaceAt(at+len(quoted))) {
+				field.value, _ = strconv.Unquote(quoted)
+				field.end = at + len(quoted)
+			}
+		}
+		fields = append(fields, field)
+		i = field.end
+	}
+	return fields
+}
+
+// 参数值包含空白或以引号开头时以双引号包围，使其可由 splitFields 还原
+func quoteValue(value string) string {
+	if strings.ContainsFunc(value, unicode.IsSpace) || strings.HasPrefix(value, `"`) {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
 var DEFAULT_COLUMNS = []Column{COLUMN_TEXT, COLUMN_WEIGHT, COLUMN_CODE, COLUMN_STEM}
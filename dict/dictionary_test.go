@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	// "github.com/lithammer/fuzzysearch/fuzzy"
 	"github.com/sahilm/fuzzy"
@@ -407,6 +411,8 @@ func Test_fastParseData(t *testing.T) {
 	cols2 := &[]Column{COLUMN_TEXT, COLUMN_WEIGHT, COLUMN_CODE}
 	cols3 := &[]Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT, COLUMN_STEM}
 	cols4 := &[]Column{COLUMN_TEXT, COLUMN_WEIGHT, COLUMN_CODE, COLUMN_STEM}
+	cols5 := &[]Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT, "comment"}
+	cols6 := &[]Column{COLUMN_TEXT, "pinyin", COLUMN_CODE, COLUMN_WEIGHT}
 	tests := []struct {
 		name string
 		raw  string
@@ -432,9 +438,13 @@ func Test_fastParseData(t *testing.T) {
 		{name: "miss weight in middle 2", raw: "加	aj", cols: cols4,
 			want: Data{Text: "加", Code: "aj", Stem: "", Weight: 0, cols: cols4}},
 		{name: "more column", raw: "加	100	aj	ak	al	ac	av", cols: cols4,
-			want: Data{Text: "加", Code: "aj", Stem: "ak", Weight: 100, cols: cols4}},
+			want: Data{Text: "加", Code: "aj", Stem: "ak", Weight: 100, Rest: "al	ac	av", cols: cols4}},
 		{name: "more column and miss weight", raw: "加	aj	ak	al	ac	av", cols: cols4,
-			want: Data{Text: "加", Code: "aj", Stem: "ak", Weight: 0, cols: cols4}},
+			want: Data{Text: "加", Code: "aj", Stem: "ak", Weight: 0, Rest: "al	ac	av", cols: cols4}},
+		{name: "extra column", raw: "加	ja	100	注释", cols: cols5,
+			want: Data{Text: "加", Code: "ja", Weight: 100, Extra: map[Column]string{"comment": "注释"}, cols: cols5}},
+		{name: "extra column in middle", raw: "加	jia	ja	100", cols: cols6,
+			want: Data{Text: "加", Code: "ja", Weight: 100, Extra: map[Column]string{"pinyin": "jia"}, cols: cols6}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -445,3 +455,245 @@ func Test_fastParseData(t *testing.T) {
 		})
 	}
 }
+
+func Test_Dictionary_Candidates(t *testing.T) {
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	fe1 := &FileEntries{ID: 1, Entries: []*Entry{
+		NewEntry([]byte("那	na	10"), 1, 0, 0, &cols),
+		NewEntry([]byte("拿	na	20"), 1, 10, 0, &cols),
+		NewEntry([]byte("哪	na	10"), 1, 20, 0, &cols),
+		NewEntry([]byte("你	ni	30"), 1, 30, 0, &cols),
+	}}
+	fe2 := &FileEntries{ID: 2, Entries: []*Entry{
+		NewEntry([]byte("纳	na	10"), 2, 0, 0, &cols),
+		NewEntry([]byte("呐	na	20"), 2, 10, 0, &cols),
+	}}
+	dc := NewDictionary([]*FileEntries{fe1, fe2}, nil)
+	added := NewEntryAdd("娜	na	10", 1, Data{Text: "娜", Code: "na", Weight: 10, cols: &cols})
+	dc.Add(added)
+	fe1.Entries[0].Delete()
+
+	got := make([]string, 0)
+	for _, c := range dc.Candidates("na") {
+		got = append(got, c.Entry.data.Text)
+	}
+	want := []string{"拿", "呐", "哪", "娜", "纳"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Candidates() = %v, want %v", got, want)
+	}
+}
+
+// 使用 go test -race 运行，检查搜索与添加、删除、修改、写入文件同时进行时是否存在数据竞争
+func Test_Dictionary_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "race.dict.yaml")
+	lines := make([]string, 0)
+	for i := range 200 {
+		lines = append(lines, fmt.Sprintf("词%d\tc%d\t%d", i, i%20, i))
+	}
+	if err := os.WriteFile(path, []byte("---\nname: race\n...\n"+strings.Join(lines, "\n")+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fes := mustLoadItems(path)
+	fe := fes[0]
+	dc := NewDictionary(fes, &CacheMatcher{})
+	entries := dc.FileEntries(fe)
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, key := range []string{"", "c1", "c12", "词1"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ch := make(chan MatchResultChunk)
+			go func() {
+				for range ch {
+				}
+			}()
+			for range 20 {
+				useColumn := COLUMN_CODE
+				if strings.HasPrefix(key, "词") {
+					useColumn = COLUMN_TEXT
+				}
+				dc.Search(key, useColumn, 0, ch, ctx)
+				_ = dc.Candidates(key)
+			}
+			close(ch)
+		}()
+	}
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := range 50 {
+			raw := fmt.Sprintf("新词%d\tc%d\t1", i, i%20)
+			dc.Add(NewEntryAdd(raw, fe.ID, fastParseData(raw, &fe.Columns)))
+			dc.ResetMatcher()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i, entry := range entries {
+			if i%3 == 0 {
+				dc.Delete(entry)
+			} else {
+				data := *entry.Data()
+				data.Weight += 1000
+				dc.ReRaw(entry, data.ToString())
+			}
+			dc.RenumberWeights(entries[:10])
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			_, _ = dc.Flush()
+			_ = dc.Stats()
+		}
+	}()
+	wg.Wait()
+	if _, err := dc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := mustLoadItems(path)[0]
+	want := 0
+	for _, entry := range dc.Entries() {
+		if !entry.IsDelete() {
+			want++
+		}
+	}
+	if len(reloaded.Entries) != want {
+		t.Errorf("reloaded entries = %d, want %d", len(reloaded.Entries), want)
+	}
+}
+
+// 接收方没有读取结果时，搜索不应阻塞写入文件，取消后搜索结束
+func Test_Dictionary_Search_blockedReceiver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.dict.yaml")
+	if err := os.WriteFile(path, []byte("你好\tnau\t1\n你\tni\t1\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fes := mustLoadItems(path)
+	dc := NewDictionary(fes, &CacheMatcher{})
+	for _, key := range []string{"", "n"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			dc.Search(key, COLUMN_CODE, 0, make(chan MatchResultChunk), ctx)
+			close(done)
+		}()
+		time.Sleep(50 * time.Millisecond) // 等待搜索阻塞在发送结果上
+		flushed := make(chan struct{})
+		go func() {
+			dc.Update(fes[0].Entries[0], func(data *Data) { data.Weight++ })
+			_, _ = dc.Flush()
+			close(flushed)
+		}()
+		select {
+		case <-flushed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Flush() blocked by Search(%q)", key)
+		}
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Search(%q) not returned after cancel", key)
+		}
+	}
+}
+
+func Test_Data_extra(t *testing.T) {
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT, "comment"}
+	raw := "你好	nau	10	常用	多余"
+	data := fastParseData(raw, &cols)
+	if got := data.ToString(); got != raw {
+		t.Errorf("ToString() = %q, want %q", got, raw)
+	}
+	// 修改其他列，超出列声明的字段保持不变
+	rest, extra := ParseExtraInput("你好 nau comment=很 11", cols)
+	pair, pcols := ParseInput(rest, false)
+	edited, _ := ParseData(pair, &pcols)
+	edited.Extra = extra
+	edited.Rest = data.Rest
+	edited.ResetColumns(&cols)
+	if got, want := edited.ToString(), "你好	nau	11	很	多余"; got != want {
+		t.Errorf("edited ToString() = %q, want %q", got, want)
+	}
+	// 包含空白的值需加引号，值之后的字段不属于此列
+	for _, tt := range []struct{ raw, rest, comment string }{
+		{`你好 nau comment="很 常用" 11`, "你好 nau 11", "很 常用"},
+		{"你好 nau comment=很　常用", "你好 nau 常用", "很"},
+		{`你好 comment="未闭合 nau`, "你好 nau", `"未闭合`},
+		{`你好 nau comment=""`, "你好 nau", ""},
+	} {
+		rest, extra := ParseExtraInput(tt.raw, cols)
+		if rest != tt.rest || extra["comment"] != tt.comment {
+			t.Errorf("ParseExtraInput(%q) = %q, %q", tt.raw, rest, extra)
+		}
+	}
+	if rest, extra := ParseExtraInput("你好 a=b", cols); rest != "你好 a=b" || extra != nil {
+		t.Errorf("ParseExtraInput() of undeclared column = %q, %v", rest, extra)
+	}
+}
+
+func Test_Data_Set(t *testing.T) {
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT, "comment"}
+	data := fastParseData("1	yi	10	数字	多余", &cols)
+	for _, tt := range []struct {
+		col     Column
+		value   string
+		wantErr bool
+	}{
+		{COLUMN_TEXT, "100", false}, // 字词可以是数字或英文，不再依靠ParseInput猜测
+		{COLUMN_CODE, "yi bai", false},
+		{COLUMN_WEIGHT, "", false},
+		{"comment", "一百", false},
+		{COLUMN_TEXT, " ", true},
+		{COLUMN_CODE, "", true},
+		{COLUMN_WEIGHT, "ten", true},
+		{COLUMN_STEM, "a b", true},
+		{"comment", "a	b", true},
+	} {
+		if err := data.Set(tt.col, tt.value); (err != nil) != tt.wantErr {
+			t.Errorf("Set(%s, %q) error = %v, wantErr %v", tt.col, tt.value, err, tt.wantErr)
+		}
+	}
+	if got, want := data.ToString(), "100	yi bai	0	一百	多余"; got != want {
+		t.Errorf("ToString() = %q, want %q", got, want)
+	}
+}
+
+func Test_Dictionary_Pending(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.dict.yaml": "---\nname: a\n...\n你好\tnau\t1\n再见\tzj\t1\n"})
+	path := filepath.Join(dir, "a.dict.yaml")
+	dc, err := Open([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := dc.Find("", "")
+	if err := dc.Update(entries[0], func(data *Data) { data.Weight = 5 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Delete(entries[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Insert(dc.fileEntries[0], Data{Text: "世界", Code: "sj", Weight: 2}); err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Type: CHANGE_MOD, FilePath: path, Raw: "你好\tnau\t5", Old: "你好\tnau\t1"},
+		{Type: CHANGE_DEL, FilePath: path, Raw: "再见\tzj\t1"},
+		{Type: CHANGE_ADD, FilePath: path, Raw: "世界\tsj\t2"},
+	}
+	if got := dc.Pending(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending() = %v, want %v", got, want)
+	}
+	if _, err := dc.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := dc.Pending(); len(got) != 0 {
+		t.Errorf("Pending() after Save = %v", got)
+	}
+}
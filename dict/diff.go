@@ -0,0 +1,141 @@
+package dict
+
+import (
+	"maps"
+	"slices"
+)
+
+type DiffType string
+
+const (
+	DIFF_ADD    DiffType = "+" // 只在新版本中存在
+	DIFF_DELETE DiffType = "-" // 只在旧版本中存在
+	DIFF_MODIFY DiffType = "~" // 两个版本中都存在，但权重或造字码不同
+)
+
+// DiffItem 是两个版本间的一处差异，以 字词+编码 作为项的标识
+type DiffItem struct {
+	Type DiffType
+	Old  *Entry // DIFF_ADD 时为nil
+	New  *Entry // DIFF_DELETE 时为nil
+}
+
+func (item DiffItem) String() string {
+	switch item.Type {
+	case DIFF_ADD:
+		return string(item.Type) + " " + item.New.Raw()
+	case DIFF_DELETE:
+		return string(item.Type) + " " + item.Old.Raw()
+	default:
+		return string(item.Type) + " " + item.Old.Raw() + " => " + item.New.Raw()
+	}
+}
+
+type entryKey struct {
+	text string
+	code string
+}
+
+func keyOf(entry *Entry) entryKey {
+	return entryKey{entry.data.Text, entry.data.Code}
+}
+
+// 以 字词+编码 为键索引entries，重复的项只保留第一个，同时返回键的顺序
+func indexEntries(entries []*Entry) (map[entryKey]*Entry, []entryKey) {
+	index := make(map[entryKey]*Entry, len(entries))
+	keys := make([]entryKey, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDelete() {
+			continue
+		}
+		key := keyOf(entry)
+		if _, ok := index[key]; ok {
+			continue
+		}
+		index[key] = entry
+		keys = append(keys, key)
+	}
+	return index, keys
+}
+
+// 两项的内容是否相同(忽略列序)
+func sameData(a, b *Entry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.data.Weight == b.data.Weight && a.data.Stem == b.data.Stem &&
+		maps.Equal(a.data.Extra, b.data.Extra) && a.data.Rest == b.data.Rest
+}
+
+// Diff 比较旧版本a与新版本b，按a中的顺序列出删除与修改的项，之后按b中的顺序列出新增的项
+func Diff(a, b []*Entry) []DiffItem {
+	oldIndex, oldKeys := indexEntries(a)
+	newIndex, newKeys := indexEntries(b)
+	items := make([]DiffItem, 0)
+	for _, key := range oldKeys {
+		o, n := oldIndex[key], newIndex[key]
+		if n == nil {
+			items = append(items, DiffItem{Type: DIFF_DELETE, Old: o})
+		} else if !sameData(o, n) {
+			items = append(items, DiffItem{Type: DIFF_MODIFY, Old: o, New: n})
+		}
+	}
+	for _, key := range newKeys {
+		if _, ok := oldIndex[key]; !ok {
+			items = append(items, DiffItem{Type: DIFF_ADD, New: newIndex[key]})
+		}
+	}
+	return items
+}
+
+// Conflict 是合并时双方都修改了同一项且结果不同，合并结果保留ours
+type Conflict struct {
+	Base   *Entry
+	Ours   *Entry
+	Theirs *Entry
+}
+
+// Merge 以base为共同的祖先，将theirs相对base的变更合并到ours中，
+// 变更只作用于ours的项上(通过Delete、ReRaw、添加新项)，之后可通过output写入文件，从而保留ours的头部与注释
+func Merge(base []*Entry, ours *FileEntries, theirs []*Entry) []Conflict {
+	baseIndex, baseKeys := indexEntries(base)
+	oursIndex, _ := indexEntries(ours.Entries)
+	theirsIndex, theirsKeys := indexEntries(theirs)
+	keys := slices.Clone(baseKeys)
+	for _, key := range theirsKeys {
+		if _, ok := baseIndex[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	conflicts := make([]Conflict, 0)
+	for _, key := range keys {
+		b, o, t := baseIndex[key], oursIndex[key], theirsIndex[key]
+		if sameData(t, b) || sameData(o, t) { // theirs没有变更，或双方变更相同
+			continue
+		}
+		if !sameData(o, b) { // 双方都有变更
+			conflicts = append(conflicts, Conflict{Base: b, Ours: o, Theirs: t})
+			continue
+		}
+		// 只有theirs有变更
+		switch {
+		case t == nil:
+			o.Delete()
+		case o == nil:
+			data := t.data
+			data.ResetColumns(&ours.Columns)
+			ours.Entries = append(ours.Entries, NewEntryAdd(data.ToString(), ours.ID, data))
+		default:
+			data := t.data
+			data.ResetColumns(&ours.Columns)
+			o.ReRaw(data.ToString())
+		}
+	}
+	return conflicts
+}
+
+// Bytes 返回将变更应用到fe的原始内容后的结果，不会写入文件，也不会改变各项的状态
+func (fe *FileEntries) Bytes() []byte {
+	bs, _, _ := applyEntries(fe.RawBs, fe.Entries, fe.InsertPolicy)
+	return bs
+}
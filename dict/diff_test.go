@@ -0,0 +1,58 @@
+package dict
+
+import (
+	"strings"
+	"testing"
+)
+
+func entriesOf(fid uint8, cols *[]Column, lines ...string) []*Entry {
+	entries := make([]*Entry, 0, len(lines))
+	seek := int64(0)
+	for _, line := range lines {
+		entries = append(entries, NewEntry([]byte(line), fid, seek, int64(len(line)+1), cols))
+		seek += int64(len(line) + 1)
+	}
+	return entries
+}
+
+func Test_Diff(t *testing.T) {
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	a := entriesOf(1, &cols, "那	na	10", "拿	na	20", "再见	zj	1")
+	b := entriesOf(2, &cols, "那	na	10", "拿	na	30", "新词	xc	5")
+	got := make([]string, 0)
+	for _, item := range Diff(a, b) {
+		got = append(got, item.String())
+	}
+	want := []string{"~ 拿	na	20 => 拿	na	30", "- 再见	zj	1", "+ 新词	xc	5"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Diff() = %q, want %q", got, want)
+	}
+}
+
+func Test_Merge(t *testing.T) {
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	base := entriesOf(1, &cols, "那	na	10", "拿	na	20", "你好	nau	3", "再见	zj	1")
+	lines := []string{"那	na	10", "拿	na	25", "你好	nau	3", "再见	zj	1", "我的	wd	1"}
+	raw := "# 注释\n" + strings.Join(lines, "\n") + "\n"
+	ours := &FileEntries{ID: 2, Columns: cols, RawBs: []byte(raw)}
+	for _, entry := range entriesOf(2, &ours.Columns, lines...) {
+		entry.seek += int64(len("# 注释\n"))
+		ours.Entries = append(ours.Entries, entry)
+	}
+	theirs := entriesOf(3, &cols, "那	na	15", "拿	na	30", "你好	nau	3", "新词	xc	5")
+	conflicts := Merge(base, ours, theirs)
+	if len(conflicts) != 1 || conflicts[0].Ours.Raw() != "拿	na	25" || conflicts[0].Theirs.Raw() != "拿	na	30" {
+		t.Errorf("Merge() conflicts = %+v", conflicts)
+	}
+	want := "# 注释\n那	na	15\n拿	na	25\n你好	nau	3\n我的	wd	1\n新词	xc	5\n"
+	if got := string(ours.Bytes()); got != want {
+		t.Errorf("Merge() = %q, want %q", got, want)
+	}
+	// Bytes 不改变各项的状态，再次调用结果相同，原始内容不变
+	if got := string(ours.Bytes()); got != want {
+		t.Errorf("Bytes() again = %q, want %q", got, want)
+	}
+	if string(ours.RawBs) != raw || ours.Entries[0].ModifyType() != MODIFY {
+		t.Errorf("Bytes() changed the entries: %q, %v", ours.RawBs, ours.Entries[0].ModifyType())
+	}
+}
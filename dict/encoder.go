@@ -0,0 +1,162 @@
+package dict
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// encoder 根据码表yaml头部中的 encoder/rules 为词组生成编码，与Rime的造词规则相同
+// 如 formula: "AaAbBaBb" 表示取第一个字的第一、二码，第二个字的第一、二码
+// 大写字母表示第几个字，小写字母表示该字编码的第几码，A-T(a-t)从前往后数，U-Z(u-z)从后往前数，Z(z)表示最后一个
+type encoder struct {
+	rules []encoderRule
+}
+
+type encoderRule struct {
+	min     int
+	max     int
+	formula string
+}
+
+func parseEncoder(config *YAML) *encoder {
+	enc, ok := (*config)["encoder"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	rules, ok := enc["rules"].([]any)
+	if !ok {
+		return nil
+	}
+	ret := &encoder{}
+	for _, r := range rules {
+		rule, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		formula, ok := rule["formula"].(string)
+		if !ok {
+			continue
+		}
+		if eq, ok := rule["length_equal"]; ok {
+			n := yamlInt(eq)
+			ret.rules = append(ret.rules, encoderRule{min: n, max: n, formula: formula})
+		} else if rg, ok := rule["length_in_range"]; ok {
+			if reflect.TypeOf(rg).Kind() == reflect.Slice {
+				rg := rg.([]any)
+				if len(rg) == 2 {
+					ret.rules = append(ret.rules, encoderRule{min: yamlInt(rg[0]), max: yamlInt(rg[1]), formula: formula})
+				}
+			}
+		}
+	}
+	if len(ret.rules) == 0 {
+		return nil
+	}
+	return ret
+}
+
+func yamlInt(v any) int {
+	n, _ := strconv.Atoi(fmt.Sprint(v))
+	return n
+}
+
+func formulaIndex(b byte, n int, base byte) int {
+	offset := int(b) - int(base)
+	if offset < 0 || offset > 25 {
+		return -1
+	}
+	if offset >= 20 { // u-z 从后往前数
+		return n - (26 - offset)
+	}
+	return offset
+}
+
+// encode 使用codeOf获取每个字的编码，按规则生成词组的编码
+func (e *encoder) encode(text string, codeOf func(r rune) string) (string, error) {
+	chars := []rune(text)
+	if len(chars) < 2 {
+		return "", fmt.Errorf("[%s] 不是词组，无法生成编码", text)
+	}
+	var rule *encoderRule
+	for i := range e.rules {
+		if len(chars) >= e.rules[i].min && len(chars) <= e.rules[i].max {
+			rule = &e.rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return "", fmt.Errorf("没有适用于 %d 字词的造词规则", len(chars))
+	}
+	codes := make([]string, len(chars))
+	for i, ch := range chars {
+		codes[i] = codeOf(ch)
+		if codes[i] == "" {
+			return "", fmt.Errorf("无法找到字 [%c] 的编码", ch)
+		}
+	}
+	code := make([]byte, 0, len(rule.formula)/2)
+	for i := 0; i+1 < len(rule.formula); i += 2 {
+		ci := formulaIndex(rule.formula[i], len(chars), 'A')
+		if ci < 0 || ci >= len(chars) {
+			continue
+		}
+		ki := formulaIndex(rule.formula[i+1], len(codes[ci]), 'a')
+		if ki < 0 || ki >= len(codes[ci]) {
+			continue
+		}
+		code = append(code, codes[ci][ki])
+	}
+	return string(code), nil
+}
+
+// Encode 按fe的造词规则为text生成编码，fe没有造词规则时使用其他词典(通常是主词典)的规则，
+// 字的编码取自所有词典中该字最长的编码
+func (d *Dictionary) Encode(text string, fe *FileEntries) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	encode, err := d.wordEncoder(fe)
+	if err != nil {
+		return "", err
+	}
+	return encode(text)
+}
+
+// 需持有锁
+func (d *Dictionary) wordEncoder(fe *FileEntries) (func(text string) (string, error), error) {
+	enc := fe.encoder
+	for _, other := range d.fileEntries {
+		if enc != nil {
+			break
+		}
+		enc = other.encoder
+	}
+	if enc == nil {
+		return nil, fmt.Errorf("码表未配置 encoder/rules，无法生成编码")
+	}
+	charCodes := make(map[rune]*Entry)
+	for _, entry := range d.entries {
+		if entry.IsDelete() {
+			continue
+		}
+		chars := []rune(entry.data.Text)
+		if len(chars) != 1 {
+			continue
+		}
+		prev, ok := charCodes[chars[0]]
+		if !ok || len(entry.data.Code) > len(prev.data.Code) ||
+			(len(entry.data.Code) == len(prev.data.Code) && entry.data.Weight > prev.data.Weight) {
+			charCodes[chars[0]] = entry
+		}
+	}
+	codes := make(map[rune]string, len(charCodes)) // 生成编码时可能已不再持有锁
+	for r, entry := range charCodes {
+		codes[r] = entry.data.Code
+	}
+	codeOf := func(r rune) string {
+		return codes[r]
+	}
+	return func(text string) (string, error) {
+		return enc.encode(text, codeOf)
+	}, nil
+}
@@ -0,0 +1,74 @@
+package dict
+
+import (
+	"testing"
+)
+
+func Test_encoder_encode(t *testing.T) {
+	config, _ := parseYAML([]byte(`
+encoder:
+  rules:
+    - length_equal: 2
+      formula: "AaAbBaBb"
+    - length_equal: 3
+      formula: "AaBaCaCb"
+    - length_in_range: [4, 10]
+      formula: "AaBaCaZa"
+`))
+	enc := parseEncoder(&config)
+	if enc == nil || len(enc.rules) != 3 {
+		t.Fatalf("parseEncoder() = %+v", enc)
+	}
+	codes := map[rune]string{'我': "tuj", '们': "jab", '的': "u", '中': "vk", '华': "hua", '人': "ren"}
+	codeOf := func(r rune) string { return codes[r] }
+	tests := []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{text: "我们", want: "tuja"},
+		{text: "我的", want: "tuu"},
+		{text: "中华人", want: "vhre"},
+		{text: "我们中华人", want: "tjvr"},
+		{text: "我", wantErr: true},
+		{text: "我他", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := enc.encode(tt.text, codeOf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("encode() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("encode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Dictionary_AddWords(t *testing.T) {
+	config, _ := parseYAML([]byte("encoder:\n  rules:\n    - length_equal: 2\n      formula: \"AaAbBaBb\"\n"))
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	fe := &FileEntries{ID: 1, Columns: cols, encoder: parseEncoder(&config)}
+	fe.Entries = []*Entry{
+		NewEntry([]byte("我	t	10"), 1, 0, 0, &fe.Columns),
+		NewEntry([]byte("我	tuj	1"), 1, 10, 0, &fe.Columns),
+		NewEntry([]byte("们	jab	1"), 1, 20, 0, &fe.Columns),
+	}
+	user := &FileEntries{ID: 2, Columns: cols}
+	dc := NewDictionary([]*FileEntries{fe, user}, nil)
+	batch, failed, err := dc.AddWords(user, []Unmatched{{Text: "我们", Weight: 5}, {Text: "他们", Weight: 3}})
+	if err != nil || batch == nil || batch.Len() != 1 {
+		t.Fatalf("AddWords() = %+v, %v", batch, err)
+	}
+	if len(failed) != 1 || failed[0].Text != "他们" {
+		t.Errorf("AddWords() failed = %+v", failed)
+	}
+	if len(user.Entries) != 1 || user.Entries[0].Raw() != "我们	tuja	5" {
+		t.Errorf("AddWords() added = %+v", user.Entries)
+	}
+	dc.Undo()
+	if !user.Entries[0].IsDelete() {
+		t.Errorf("Undo() should delete added entry")
+	}
+}
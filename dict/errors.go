@@ -0,0 +1,64 @@
+package dict
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+var (
+	// 无法从码表的第一个有效项中确定列序，此时使用默认的列序 [字词 编码 权重]
+	ErrColumnAmbiguous = errors.New("无法自动解析列序([字词 编码 [权重?]])")
+	// 码表头部的YAML无法解析
+	ErrInvalidHeader = errors.New("码表头部的YAML格式有误")
+	// 要修改的项已被删除
+	ErrEntryDeleted = errors.New("此项已被删除")
+	// 所在的文件已重新读取(如被钩子格式化)，此项已被替换
+	ErrStale = errors.New("此项所在的文件已重新读取，请重新搜索后再修改")
+	// 文件不属于此Dictionary
+	ErrFileNotLoaded = errors.New("文件未加载")
+	// 编码中有方案的字母表(speller/alphabet)与分隔符以外的字符
+	ErrCodeAlphabet = errors.New("编码中有方案无法输入的字符")
+	// 编码超过方案的最大码长(speller/max_code_length)
+	ErrCodeTooLong = errors.New("编码超过方案的最大码长")
+	// 文件是只读的
+	ErrReadonly = errors.New("只读文件不能修改")
+	// 同一文件中 字词+编码 相同的项
+	ErrDuplicate = errors.New("重复的项")
+	// 文件中有尚未写入的修改
+	ErrUnsaved = errors.New("有未写入文件的修改")
+	// 文件在加载或上次写入后被其他程序(如钩子)修改，写入会覆盖其中的修改
+	ErrModifiedOutside = errors.New("文件已被其他程序修改，为避免覆盖其中的修改而未写入，请重新打开本程序")
+)
+
+// FileError 是读写码表文件时的错误，可通过 errors.Is 判断具体原因，
+// 如 fs.ErrNotExist(文件不存在)、fs.ErrPermission(没有权限)、ErrInvalidHeader、ErrColumnAmbiguous
+type FileError struct {
+	Op   string // 加载、解析、写入、导出
+	Path string
+	Line int // 出错的行号，从1开始，0表示与具体的行无关
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s %s:%d: %v", e.Op, e.Path, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// 包装文件操作的错误，*fs.PathError 中已包含路径，只保留其底层错误
+func fileError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return &FileError{Op: op, Path: path, Err: err}
+}
@@ -0,0 +1,88 @@
+package dict_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MapoMagpie/rimedm/dict"
+)
+
+// 在临时目录中创建一个码表文件
+func writeExampleDict() (string, func()) {
+	dir, err := os.MkdirTemp("", "rimedm-example")
+	if err != nil {
+		panic(err)
+	}
+	path := filepath.Join(dir, "example.dict.yaml")
+	content := "---\nname: example\ncolumns:\n  - text\n  - code\n  - weight\n...\n你好\tnau\t1\n那\tna\t10\n拿\tna\t20\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		panic(err)
+	}
+	return path, func() { _ = os.RemoveAll(dir) }
+}
+
+func ExampleOpen() {
+	path, cleanup := writeExampleDict()
+	defer cleanup()
+
+	dc, err := dict.Open([]string{path}, &dict.OpenOptions{Strict: true})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for entry := range dc.All() {
+		fmt.Printf("%s %s %d\n", entry.Data().Text, entry.Data().Code, entry.Data().Weight)
+	}
+	// Output:
+	// 你好 nau 1
+	// 那 na 10
+	// 拿 na 20
+}
+
+func ExampleDictionary_Save() {
+	path, cleanup := writeExampleDict()
+	defer cleanup()
+
+	dc, err := dict.Open([]string{path}, nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, entry := range dc.Find("那", "na") {
+		_ = dc.Update(entry, func(data *dict.Data) {
+			data.Weight = 30
+		})
+	}
+	for _, entry := range dc.Find("你好", "") {
+		dc.Delete(entry)
+	}
+	for fe := range dc.Files() {
+		_, _ = dc.Insert(fe, dict.Data{Text: "再见", Code: "zj", Weight: 1})
+	}
+	changes, err := dc.Save(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, c := range changes {
+		fmt.Println(c.Type, c.Raw)
+	}
+	bs, _ := os.ReadFile(path)
+	fmt.Print(string(bs))
+	// Output:
+	// ADD 再见	zj	1
+	// DEL 你好	nau	1
+	// MOD 那	na	30
+	// ---
+	// name: example
+	// columns:
+	//   - text
+	//   - code
+	//   - weight
+	// ...
+	// 那	na	30
+	// 拿	na	20
+	// 再见	zj	1
+}
@@ -0,0 +1,209 @@
+package dict
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// FormatOrder 是格式化码表时项的排序方式
+type FormatOrder int
+
+const (
+	FORMAT_BY_CODE FormatOrder = iota // 按编码排序，编码相同时按权重从高到低，无权重时保持原有的行序
+	FORMAT_BY_TEXT                    // 按字词排序，字词相同时按编码、权重
+)
+
+// FormatStats 是格式化一个码表的结果
+type FormatStats struct {
+	Changed    bool // 内容是否有变化
+	Entries    int  // 格式化后的项数
+	Duplicates int  // 删除的重复项数
+}
+
+type formatLine struct {
+	raw  string
+	data Data
+}
+
+// Format 格式化码表的内容：头部(YAML)原样保留；注释与空行保留在原处，其间的项分别排序；
+// 以单个制表符分隔各列，去除行尾的空白与完全相同的重复项
+func Format(bs []byte, columns []Column, order FormatOrder) ([]byte, FormatStats) {
+	var stats FormatStats
+	out := bytes.NewBuffer(make([]byte, 0, len(bs)))
+	body := bs
+	if _, size, existHead := tryReadHead(bytes.NewBuffer(bs)); existHead {
+		out.Write(bs[:size])
+		body = bs[size:]
+	}
+	hasWeight := slices.Contains(columns, COLUMN_WEIGHT)
+	less := func(a, b *Data) bool {
+		if order == FORMAT_BY_TEXT && a.Text != b.Text {
+			return a.Text < b.Text
+		}
+		if a.Code != b.Code {
+			return a.Code < b.Code
+		}
+		return hasWeight && a.Weight > b.Weight
+	}
+	seen := make(map[string]bool)
+	block := make([]formatLine, 0) // 注释或空行之间的项
+	writeBlock := func() {
+		sort.SliceStable(block, func(i, j int) bool {
+			return less(&block[i].data, &block[j].data)
+		})
+		for _, line := range block {
+			out.WriteString(line.raw)
+			out.WriteByte('\n')
+		}
+		stats.Entries += len(block)
+		block = block[:0]
+	}
+	lines := strings.Split(string(body), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || line[0] == '#' { // 与加载码表时一致，仅以#开头的行为注释
+			writeBlock()
+			out.WriteString(line)
+			out.WriteByte('\n')
+			continue
+		}
+		line = normalizeSeparators(line, len(columns))
+		if seen[line] {
+			stats.Duplicates++
+			continue
+		}
+		seen[line] = true
+		block = append(block, formatLine{raw: line, data: fastParseData(line, &columns)})
+	}
+	writeBlock()
+	stats.Changed = !bytes.Equal(out.Bytes(), bs)
+	return out.Bytes(), stats
+}
+
+// 去除各列两侧的空格与行尾的空列；列数超出列声明时，视连续的制表符为误输入，去除其间的空列
+func normalizeSeparators(line string, columns int) string {
+	fields := strings.Split(line, "\t")
+	for i := range fields {
+		fields[i] = strings.Trim(fields[i], " ")
+	}
+	if len(fields) > columns {
+		fields = slices.DeleteFunc(fields, func(f string) bool { return f == "" })
+	}
+	for len(fields) > 1 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return strings.Join(fields, "\t")
+}
+
+// Format 格式化fe所在的文件并写入，之后重新读取fe中的项，fe中不能有未写入文件的修改。
+// 涉及fe的批量调整将无法再撤销
+func (d *Dictionary) Format(fe *FileEntries, order FormatOrder) (FormatStats, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !slices.Contains(d.fileEntries, fe) {
+		return FormatStats{}, ErrFileNotLoaded
+	}
+	if fe.Readonly {
+		return FormatStats{}, ErrReadonly
+	}
+	if fe.unsaved() {
+		return FormatStats{}, ErrUnsaved
+	}
+	if fe.modifiedOutside() {
+		return FormatStats{}, fileError("写入", fe.FilePath, ErrModifiedOutside)
+	}
+	if len(fe.Entries) == 0 { // 没有有效项时列序未知
+		return FormatStats{}, nil
+	}
+	bs, stats := Format(fe.RawBs, fe.Columns, order)
+	if !stats.Changed {
+		return stats, nil
+	}
+	if err := rewriteFile(fe.FilePath, bs); err != nil {
+		return FormatStats{}, err
+	}
+	fe.restamp()
+	d.replaceEntries(fe, bs)
+	return stats, nil
+}
+
+// Reload 重新读取被其他程序(如钩子中的格式化命令)修改、且没有未写入的修改的文件，返回重新读取的文件。
+// 这些文件中此前的修改不能再撤销
+func (d *Dictionary) Reload() ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	reloaded := make([]string, 0)
+	var errs []error
+	for _, fe := range d.fileEntries {
+		if len(fe.Columns) == 0 || fe.unsaved() || !fe.modifiedOutside() {
+			continue
+		}
+		bs, err := os.ReadFile(fe.FilePath)
+		if err != nil {
+			errs = append(errs, fileError("加载", fe.FilePath, err))
+			continue
+		}
+		fe.restamp()
+		d.replaceEntries(fe, bs)
+		reloaded = append(reloaded, fe.FilePath)
+	}
+	if len(reloaded) > 0 {
+		d.matcher.Reset()
+	}
+	return reloaded, errors.Join(errs...)
+}
+
+// 以码表内容bs重新读取fe中的项，在原有的位置替换，保持搜索结果的顺序；丢弃修改过fe的批量修改。
+// 原有的项标记为已替换，仍持有这些项的调用者修改时将得到 ErrStale
+func (d *Dictionary) replaceEntries(fe *FileEntries, bs []byte) {
+	for _, entry := range fe.Entries {
+		entry.stale = true
+	}
+	fe.RawBs = bs
+	fe.Entries = readEntries(bs, fe)
+	i := slices.IndexFunc(d.entries, func(e *Entry) bool { return e.FID == fe.ID })
+	d.entries = slices.DeleteFunc(d.entries, func(e *Entry) bool { return e.FID == fe.ID })
+	d.entries = slices.Insert(d.entries, max(min(i, len(d.entries)), 0), fe.Entries...)
+	d.history = slices.DeleteFunc(d.history, func(b *Batch) bool { return b.touches(fe) })
+}
+
+// 从码表内容中读取所有项，fe的列序需已确定
+func readEntries(bs []byte, fe *FileEntries) []*Entry {
+	var seek int64
+	if _, size, existHead := tryReadHead(bytes.NewBuffer(bs)); existHead {
+		seek = size
+	}
+	entries := make([]*Entry, 0)
+	for seek < int64(len(bs)) {
+		line := bs[seek:]
+		if i := bytes.IndexByte(line, '\n'); i != -1 {
+			line = line[:i+1]
+		}
+		if raw := bytes.TrimSpace(line); len(raw) > 0 && line[0] != '#' {
+			entries = append(entries, NewEntry(raw, fe.ID, seek, int64(len(line)), &fe.Columns))
+		}
+		seek += int64(len(line))
+	}
+	return entries
+}
+
+// 以新的内容覆盖文件，保留文件的权限
+func rewriteFile(path string, bs []byte) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		return fileError("写入", path, err)
+	}
+	defer func() { _ = file.Close() }()
+	l, err := file.Write(bs)
+	if err == nil {
+		err = file.Truncate(int64(l))
+	}
+	return fileError("写入", path, err)
+}
@@ -0,0 +1,164 @@
+package dict
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Format(t *testing.T) {
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	head := "# 注释\n---\nname: a\nsort: by_weight  \n...\n"
+	body := "# 单字  \n" +
+		"那\tna\t1\n" +
+		"你 \tni\t\t30 \r\n" +
+		"拿\tna\t3\t\n" +
+		"那\tna\t1\n" +
+		"\n" +
+		"# 词组\n" +
+		"你好\tnau\n" +
+		"阿\ta"
+	tests := []struct {
+		name  string
+		order FormatOrder
+		want  string
+	}{
+		{"by code", FORMAT_BY_CODE, head + "# 单字\n" +
+			"拿\tna\t3\n" +
+			"那\tna\t1\n" +
+			"你\tni\t30\n" +
+			"\n" +
+			"# 词组\n" +
+			"阿\ta\n" +
+			"你好\tnau\n"},
+		{"by text", FORMAT_BY_TEXT, head + "# 单字\n" +
+			"你\tni\t30\n" +
+			"拿\tna\t3\n" +
+			"那\tna\t1\n" +
+			"\n" +
+			"# 词组\n" +
+			"你好\tnau\n" +
+			"阿\ta\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, stats := Format([]byte(head+body), cols, tt.order)
+			if string(got) != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+			if stats != (FormatStats{Changed: true, Entries: 5, Duplicates: 1}) {
+				t.Errorf("Format() stats = %+v", stats)
+			}
+			again, stats := Format(got, cols, tt.order)
+			if string(again) != tt.want || stats.Changed {
+				t.Errorf("Format() again = %q, %+v", again, stats)
+			}
+		})
+	}
+	// 无头的码表，声明的列内的空列保留
+	got, _ := Format([]byte("你\tni\t\tstem  \n"), []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT, COLUMN_STEM}, FORMAT_BY_CODE)
+	if string(got) != "你\tni\t\tstem\n" {
+		t.Errorf("Format() without head = %q", got)
+	}
+}
+
+func Test_Dictionary_Format(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.dict.yaml")
+	if err := os.WriteFile(path, []byte("---\nname: a\n...\n你\tni\t1\n那\tna\t1\n再\tzai\t1\n你\tni\t1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := Open([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe := dc.fileEntries[0]
+	if _, err := dc.ToOrderOnly(fe); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Format(fe, FORMAT_BY_CODE); err != ErrUnsaved {
+		t.Fatalf("Format() with pending changes err = %v, want %v", err, ErrUnsaved)
+	}
+	if err := dc.Delete(dc.Find("再", "")[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := dc.Format(fe, FORMAT_BY_CODE)
+	if err != nil || stats != (FormatStats{Changed: true, Entries: 2, Duplicates: 1}) {
+		t.Fatalf("Format() = %+v, %v", stats, err)
+	}
+	if b, _ := dc.Undo(); b != nil {
+		t.Errorf("batches of the formatted file should be dropped")
+	}
+	if dc.Len() != 2 || len(dc.Find("你", "ni")) != 1 {
+		t.Errorf("entries after Format() = %d", dc.Len())
+	}
+	// 重新读取的项可以继续修改
+	if err := dc.ReRaw(dc.Find("你", "ni")[0], "你\tnii"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := os.ReadFile(path)
+	if want := "---\nname: a\n...\n那\tna\n你\tnii\n"; string(bs) != want {
+		t.Errorf("file = %q, want %q", bs, want)
+	}
+}
+
+func Test_Dictionary_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.dict.yaml")
+	if err := os.WriteFile(path, []byte("---\nname: a\n...\n那\tna\t1\n你\tni\t1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := Open([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.ReRaw(dc.Find("那", "")[0], "那\tna\t2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := dc.Reload(); err != nil || len(reloaded) != 0 {
+		t.Errorf("Reload() unchanged file = %v, %v", reloaded, err)
+	}
+	stale := dc.Find("那", "")[0] // 如Tui的列表与编辑表单仍持有的项
+	// 如post_flush钩子格式化了文件
+	formatted := "---\nname: a\n...\n你\tni\t1\n那\tna\t2\n再\tzai\t1\n"
+	if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := dc.Reload(); err != nil || len(reloaded) != 1 {
+		t.Fatalf("Reload() = %v, %v", reloaded, err)
+	}
+	if dc.Len() != 3 {
+		t.Errorf("entries after Reload() = %d", dc.Len())
+	}
+	// 修改已被替换的项不会被写入，需返回错误
+	if err := dc.ReRaw(stale, "那\tna\t3"); !errors.Is(err, ErrStale) {
+		t.Errorf("ReRaw() stale entry err = %v, want ErrStale", err)
+	}
+	if err := dc.Update(stale, func(data *Data) { data.Weight = 3 }); !errors.Is(err, ErrStale) {
+		t.Errorf("Update() stale entry err = %v, want ErrStale", err)
+	}
+	if err := dc.Delete(stale); !errors.Is(err, ErrStale) {
+		t.Errorf("Delete() stale entry err = %v, want ErrStale", err)
+	}
+	if dc.ClampWeights([]*Entry{stale}, 5, 0) != nil {
+		t.Errorf("ClampWeights() should skip stale entries")
+	}
+	// 之后的修改基于重新读取的内容
+	if err := dc.Delete(dc.Find("你", "")[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := os.ReadFile(path); string(bs) != "---\nname: a\n...\n那\tna\t2\n再\tzai\t1\n" {
+		t.Errorf("file = %q", bs)
+	}
+}
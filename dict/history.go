@@ -0,0 +1,119 @@
+package dict
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type ChangeType string
+
+const (
+	CHANGE_ADD ChangeType = "ADD"
+	CHANGE_MOD ChangeType = "MOD"
+	CHANGE_DEL ChangeType = "DEL"
+	// 只移动了所在的行，改变了候选顺序，内容不变
+	CHANGE_MOVE ChangeType = "MOVE"
+)
+
+// Change 是一次写入文件的变更，可格式化为一行文本(用于日志与git提交信息)，并可通过 ParseChange 解析回来
+type Change struct {
+	Type     ChangeType
+	FilePath string
+	Raw      string // 新增、修改后或删除前的内容
+	Old      string // 修改前的内容，仅CHANGE_MOD
+}
+
+func (c Change) String() string {
+	s := string(c.Type) + " " + c.FilePath + " | "
+	if c.Type == CHANGE_MOD {
+		return s + c.Old + " => " + c.Raw
+	}
+	return s + c.Raw
+}
+
+// ParseChange 解析由 Change.String 生成的一行文本
+func ParseChange(line string) (Change, bool) {
+	typ, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return Change{}, false
+	}
+	c := Change{Type: ChangeType(typ)}
+	switch c.Type {
+	case CHANGE_ADD, CHANGE_MOD, CHANGE_DEL, CHANGE_MOVE:
+	default:
+		return Change{}, false
+	}
+	c.FilePath, c.Raw, ok = strings.Cut(rest, " | ")
+	if !ok {
+		return Change{}, false
+	}
+	if c.Type == CHANGE_MOD {
+		c.Old, c.Raw, ok = strings.Cut(c.Raw, " => ")
+		if !ok {
+			return Change{}, false
+		}
+	}
+	return c, true
+}
+
+// Mentions 判断变更前后的内容是否包含字词text与编码code
+func (c Change) Mentions(text, code string) bool {
+	mentions := func(raw string) bool {
+		fields := strings.Split(raw, "\t")
+		hasText, hasCode := false, false
+		for _, f := range fields {
+			hasText = hasText || f == text
+			hasCode = hasCode || f == code
+		}
+		return hasText && hasCode
+	}
+	return mentions(c.Raw) || (c.Type == CHANGE_MOD && mentions(c.Old))
+}
+
+// RevertChange 在内存中还原一次变更：删除新增的项、恢复删除的项、将修改的项改回修改前的内容
+func (d *Dictionary) RevertChange(c Change) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var fe *FileEntries
+	for _, f := range d.fileEntries {
+		if f.FilePath == c.FilePath {
+			fe = f
+			break
+		}
+	}
+	if fe == nil {
+		return fmt.Errorf("文件未加载: %s", c.FilePath)
+	}
+	if fe.Readonly {
+		return ErrReadonly
+	}
+	find := func(raw string) *Entry {
+		for _, entry := range fe.Entries {
+			if !entry.IsDelete() && entry.raw == raw {
+				return entry
+			}
+		}
+		return nil
+	}
+	switch c.Type {
+	case CHANGE_ADD, CHANGE_MOD:
+		entry := find(c.Raw)
+		if entry == nil {
+			return fmt.Errorf("文件中已不存在: %s", c.Raw)
+		}
+		if c.Type == CHANGE_ADD {
+			entry.Delete()
+		} else {
+			entry.ReRaw(c.Old)
+		}
+	case CHANGE_MOVE:
+		return errors.New("移动行的变更无法还原")
+	case CHANGE_DEL:
+		if find(c.Raw) != nil {
+			return fmt.Errorf("文件中已存在: %s", c.Raw)
+		}
+		d.add(NewEntryAdd(c.Raw, fe.ID, fastParseData(c.Raw, &fe.Columns)))
+	}
+	return nil
+}
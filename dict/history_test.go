@@ -0,0 +1,57 @@
+package dict
+
+import (
+	"testing"
+)
+
+func Test_ParseChange(t *testing.T) {
+	changes := []Change{
+		{Type: CHANGE_ADD, FilePath: "a.dict.yaml", Raw: "你好	nau	1"},
+		{Type: CHANGE_MOD, FilePath: "rime/a b.dict.yaml", Raw: "拿	na	30", Old: "拿	na	20"},
+		{Type: CHANGE_DEL, FilePath: "a.dict.yaml", Raw: "再见	zj	1"},
+	}
+	for _, c := range changes {
+		got, ok := ParseChange(c.String())
+		if !ok || got != c {
+			t.Errorf("ParseChange(%q) = %+v, %v", c.String(), got, ok)
+		}
+	}
+	for _, line := range []string{"", "rimedm: 新增 1 项", "ADD a.dict.yaml", "MOD a.dict.yaml | 拿	na	30"} {
+		if _, ok := ParseChange(line); ok {
+			t.Errorf("ParseChange(%q) should fail", line)
+		}
+	}
+}
+
+func Test_Dictionary_RevertChange(t *testing.T) {
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	fe := &FileEntries{ID: 1, FilePath: "a.dict.yaml", Columns: cols}
+	fe.Entries = entriesOf(1, &fe.Columns, "那	na	10", "拿	na	30", "你好	nau	1")
+	dc := NewDictionary([]*FileEntries{fe}, nil)
+	changes := []Change{
+		{Type: CHANGE_ADD, FilePath: "a.dict.yaml", Raw: "你好	nau	1"},
+		{Type: CHANGE_MOD, FilePath: "a.dict.yaml", Raw: "拿	na	30", Old: "拿	na	20"},
+		{Type: CHANGE_DEL, FilePath: "a.dict.yaml", Raw: "再见	zj	1"},
+	}
+	for _, c := range changes {
+		if err := dc.RevertChange(c); err != nil {
+			t.Fatalf("RevertChange(%s) error: %v", c, err)
+		}
+	}
+	got := make([]string, 0)
+	for _, entry := range dc.Entries() {
+		if !entry.IsDelete() {
+			got = append(got, entry.Raw())
+		}
+	}
+	want := []string{"那	na	10", "拿	na	20", "再见	zj	1"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("RevertChange() entries = %q, want %q", got, want)
+	}
+	if err := dc.RevertChange(changes[0]); err == nil {
+		t.Errorf("RevertChange() of a missing entry should fail")
+	}
+	if err := dc.RevertChange(Change{Type: CHANGE_ADD, FilePath: "b.dict.yaml", Raw: "那	na	10"}); err == nil {
+		t.Errorf("RevertChange() of an unloaded file should fail")
+	}
+}
@@ -0,0 +1,69 @@
+package dict
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Issue 是码表中某一项的问题
+type Issue struct {
+	FilePath string
+	Line     int // 项所在的行号，尚未写入文件的项为0
+	Raw      string
+	Err      error
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s:%d: %v\t[%s]", i.FilePath, i.Line, i.Err, i.Raw)
+}
+
+// Lint 检查所有文件中编码不符合方案(见 CodeRule)与重复的项，按文件与行序排列
+func (d *Dictionary) Lint() []Issue {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	issues := make([]Issue, 0)
+	for _, fe := range d.fileEntries {
+		entries := make([]*Entry, 0, len(fe.Entries))
+		for _, entry := range fe.Entries {
+			if !entry.IsDelete() {
+				entries = append(entries, entry)
+			}
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return physicalLess(entries[i], entries[j])
+		})
+		lineOf := lineCounter(fe.RawBs)
+		seen := make(map[entryKey]int)
+		for _, entry := range entries {
+			line := 0
+			if entry.modType != ADD {
+				line = lineOf(entry.seek)
+			}
+			issue := Issue{FilePath: fe.FilePath, Line: line, Raw: entry.raw}
+			if err := fe.CodeRule.Check(entry.data.Code); err != nil {
+				issue.Err = err
+				issues = append(issues, issue)
+			}
+			key := keyOf(entry)
+			if first, ok := seen[key]; ok {
+				issue.Err = fmt.Errorf("%w，与第 %d 行相同", ErrDuplicate, first)
+				issues = append(issues, issue)
+				continue
+			}
+			seen[key] = line
+		}
+	}
+	return issues
+}
+
+// 返回计算偏移所在行号的函数，偏移需递增
+func lineCounter(bs []byte) func(seek int64) int {
+	line, last := 1, int64(0)
+	return func(seek int64) int {
+		seek = min(seek, int64(len(bs)))
+		line += bytes.Count(bs[last:seek], []byte{'\n'})
+		last = seek
+		return line
+	}
+}
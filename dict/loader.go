@@ -5,12 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 
 	"github.com/MapoMagpie/rimedm/util"
@@ -18,12 +20,93 @@ import (
 )
 
 type FileEntries struct {
-	Err      error
+	Err error
+	// 不影响加载的问题，如无法解析列序时使用了默认的列序
+	Warnings []error
 	FilePath string
 	RawBs    []byte
 	Entries  []*Entry
 	Columns  []Column
 	ID       uint8
+	// 列序是否在码表的yaml头部中声明
+	columnsDeclared bool
+	// 码表yaml头部中的造词规则
+	encoder *encoder
+	// 使用此码表的方案对编码的限制，拓展词典沿用主词典的，未找到方案时为nil
+	CodeRule *CodeRule
+	// 只读文件可以搜索，但不能修改，也不会写入
+	Readonly bool
+	// 新增的项写入文件的位置，由码表yaml头部的sort决定
+	InsertPolicy InsertPolicy
+	// 加载或上次写入后文件的状态，用于发现其他程序对文件的修改
+	stamp fileStamp
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func stampOf(info os.FileInfo) fileStamp {
+	return fileStamp{info.ModTime(), info.Size()}
+}
+
+// 在读取或写入文件后记录文件的状态
+func (fe *FileEntries) restamp() {
+	if info, err := os.Stat(fe.FilePath); err == nil {
+		fe.stamp = stampOf(info)
+	}
+}
+
+// 文件是否在加载或上次写入后被其他程序修改，没有记录文件的状态时视为未修改
+func (fe *FileEntries) modifiedOutside() bool {
+	if fe.stamp == (fileStamp{}) {
+		return false
+	}
+	info, err := os.Stat(fe.FilePath)
+	if err != nil { // 文件不存在等错误在写入时报告
+		return false
+	}
+	stamp := stampOf(info)
+	return !stamp.modTime.Equal(fe.stamp.modTime) || stamp.size != fe.stamp.size
+}
+
+// 是否有尚未写入文件的修改
+func (fe *FileEntries) unsaved() bool {
+	return slices.ContainsFunc(fe.Entries, func(e *Entry) bool { return e.modType != NC })
+}
+
+// InsertPolicy 决定新增的项写入文件的位置
+type InsertPolicy uint8
+
+const (
+	INSERT_APPEND  InsertPolicy = iota // 追加到文件末尾，用于按权重排序(sort: by_weight，默认)的码表
+	INSERT_BY_CODE                     // 插入到编码相同的最后一项之后，没有时插入到编码更小的最后一项之后，用于按行序排序(sort: original)的码表
+)
+
+// 码表yaml头部的sort对应的InsertPolicy
+func insertPolicyOf(config *YAML) InsertPolicy {
+	if sort, ok := (*config)["sort"].(string); ok && sort == "original" {
+		return INSERT_BY_CODE
+	}
+	return INSERT_APPEND
+}
+
+// SetReadonly 将路径与patterns中任一项相同或匹配(filepath.Match)的文件设置为只读
+func SetReadonly(fes []*FileEntries, patterns []string) error {
+	for _, pattern := range patterns {
+		pattern = filepath.Clean(pattern)
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("只读文件的路径[%s]有误: %w", pattern, err)
+		}
+		for _, fe := range fes {
+			path := filepath.Clean(fe.FilePath)
+			if matched, _ := filepath.Match(pattern, path); matched || path == pattern {
+				fe.Readonly = true
+			}
+		}
+	}
+	return nil
 }
 
 func (fe *FileEntries) Id() int {
@@ -41,13 +124,15 @@ func (fe *FileEntries) Cmp(ofe any) bool {
 	return false
 }
 
-func LoadItems(paths ...string) (fes []*FileEntries) {
+// LoadItems 加载码表文件及其引用的拓展词典，任一文件加载失败时返回所有的错误
+func LoadItems(paths ...string) (fes []*FileEntries, err error) {
 	fes = make([]*FileEntries, 0)
+	errs := make([]error, 0)
 	ch := make(chan *FileEntries)
 	var wg sync.WaitGroup
 	for _, path := range paths {
 		wg.Add(1)
-		go loadFromFile(path, util.IDGen.NextID(), nil, ch, &wg)
+		go loadFromFile(path, util.IDGen.NextID(), nil, nil, true, ch, &wg)
 	}
 	go func() {
 		wg.Wait()
@@ -56,17 +141,20 @@ func LoadItems(paths ...string) (fes []*FileEntries) {
 	fileNames := make(map[string]bool)
 	for fe := range ch {
 		if fe.Err != nil {
-			fmt.Println("load dict file error: ", fe.Err)
-			os.Exit(0)
+			errs = append(errs, fe.Err)
+			continue
 		}
 		if _, ok := fileNames[fe.FilePath]; ok {
-			log.Printf("file [%s] already loaded", fe.FilePath)
+			slog.Debug("file already loaded", "path", fe.FilePath)
 			continue
 		}
 		fileNames[fe.FilePath] = true
 		fes = append(fes, fe)
 	}
-	return
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return fes, nil
 }
 
 var (
@@ -74,11 +162,22 @@ var (
 	YAML_END   = "..."
 )
 
-func loadFromFile(path string, id uint8, columns *[]Column, ch chan<- *FileEntries, wg *sync.WaitGroup) {
+// LoadFile 加载单个码表文件，不加载其引用的拓展词典
+func LoadFile(path string) (*FileEntries, error) {
+	ch := make(chan *FileEntries, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	loadFromFile(path, util.IDGen.NextID(), nil, nil, false, ch, &wg)
+	fe := <-ch
+	return fe, fe.Err
+}
+
+// columns与rule来自主词典，加载主词典时为nil
+func loadFromFile(path string, id uint8, columns *[]Column, rule *CodeRule, withExtends bool, ch chan<- *FileEntries, wg *sync.WaitGroup) {
 	defer wg.Done()
-	fe := &FileEntries{FilePath: path, Entries: make([]*Entry, 0), ID: id}
+	fe := &FileEntries{FilePath: path, Entries: make([]*Entry, 0), ID: id, CodeRule: rule}
 	file, err := os.OpenFile(path, os.O_RDONLY, 0666)
-	if fe.Err = err; err != nil {
+	if fe.Err = fileError("加载", path, err); err != nil {
 		ch <- fe
 		return
 	}
@@ -86,42 +185,59 @@ func loadFromFile(path string, id uint8, columns *[]Column, ch chan<- *FileEntri
 		_ = file.Close()
 	}()
 	stat, err := file.Stat()
-	if fe.Err = err; err != nil {
+	if fe.Err = fileError("加载", path, err); err != nil {
 		ch <- fe
 		return
 	}
+	fe.stamp = stampOf(stat)
 	bf := bytes.NewBuffer(make([]byte, 0, stat.Size()))
 	_, err = io.Copy(bf, file)
 	fe.RawBs = bf.Bytes()
-	if fe.Err = err; err != nil {
+	if fe.Err = fileError("加载", path, err); err != nil {
 		ch <- fe
 		return
 	}
 
 	var seek int64 = 0
+	line := 0 // 当前行号
 	// 在开始读取 码 之前，尝试先读取yaml内容，
 	// 但是此文件也可能不包含yaml内容，
 	// 如果不包含yaml，那么head(buffer)将与bf(buffer)一起用于读取 码
 	head, size, existHead := tryReadHead(bf)
+	var config YAML
 	if existHead {
-		raw, err := io.ReadAll(head)
-		if err != nil {
-			panic("cant readAll bytes from head buffer")
-		}
+		raw := head.Bytes()
 		seek = size
-		config, _ := parseYAML(raw)
+		line = bytes.Count(raw, []byte{'\n'})
+		config, err = parseYAML(raw)
+		if err != nil { // 与之前的行为保持一致，忽略头部的配置，继续读取码表
+			fe.Warnings = append(fe.Warnings, headerError(path, err))
+		}
 		fe.Columns, _ = parseColumnsFromYAML(&config)
-		loadExtendDict(path, &config, &fe.Columns, ch, wg)
+		fe.columnsDeclared = fe.Columns != nil
+		fe.encoder = parseEncoder(&config)
+		fe.InsertPolicy = insertPolicyOf(&config)
+		if withExtends {
+			// 拓展词典沿用主词典的列序，需在读取完所有项(列序可能从第一个有效项中解析)后再加载
+			defer loadExtendDict(path, &config, fe, ch, wg)
+		}
 	}
 	if fe.Columns == nil && columns != nil {
 		fe.Columns = *columns
 	}
+	if columns == nil { // 主词典
+		fe.CodeRule, err = findCodeRule(path, dictName(path, &config))
+		if err != nil {
+			fe.Warnings = append(fe.Warnings, err)
+		}
+	}
 	// 函数：读取 码
 	readEntries := func(buf *bytes.Buffer) {
 		for {
 			bs, eof := buf.ReadBytes('\n')
 			size := len(bs)
 			seek += int64(size)
+			line++
 			if size > 0 {
 				if bs[0] == '#' {
 					continue
@@ -139,19 +255,8 @@ func loadFromFile(path string, id uint8, columns *[]Column, ch chan<- *FileEntri
 					}
 					fe.Columns, err = tryParseColumns(splits)
 					if err != nil {
-						fmt.Fprintf(os.Stderr, "\x1b[31m警告：无法自动解析 列序([字词 编码 [权重?]])\x1b[0m\n"+
-							`码表中的第一个有效项必须包含 英文和汉字，以制表符隔开，如 [nihao 你好]、[你好 nihao]
-当前第一个有效项为：[%s]，位于： %s
-
-！！！现启用默认的列序： [字词 编码 权重]，若与码表实际的列序不同，将导致无法搜索与修改！
-请解决此问题在 %s 中
-方式一：使码表的第一个有效项包含英文和汉字；
-方式二：在码表的配置中指定columns
-columns:
-  - text
-  - weight
-  - code
-`, string(bs), path, path)
+						fe.Warnings = append(fe.Warnings, &FileError{Op: "解析", Path: path, Line: line,
+							Err: fmt.Errorf("%w，第一个有效项为: [%s]", ErrColumnAmbiguous, string(bs))})
 						fe.Columns = []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
 					}
 				}
@@ -254,26 +359,34 @@ func parseColumnsFromYAML(config *YAML) ([]Column, error) {
 	}
 	result := make([]Column, 0)
 	for _, col := range cols {
-		switch col {
-		case "text":
-			result = append(result, COLUMN_TEXT)
-		case "weight":
-			result = append(result, COLUMN_WEIGHT)
-		case "code":
-			result = append(result, COLUMN_CODE)
-		case "stem":
-			result = append(result, COLUMN_STEM)
-		}
+		result = append(result, columnOf(col))
 	}
 	return result, nil
 }
 
-func loadExtendDict(path string, config *YAML, columns *[]Column, ch chan<- *FileEntries, wg *sync.WaitGroup) {
+// 将码表中声明的列名转换为Column
+func columnOf(name string) Column {
+	switch name {
+	case "text":
+		return COLUMN_TEXT
+	case "weight":
+		return COLUMN_WEIGHT
+	case "code":
+		return COLUMN_CODE
+	case "stem":
+		return COLUMN_STEM
+	default: // 其他列，如注释
+		return Column(name)
+	}
+}
+
+func loadExtendDict(path string, config *YAML, parent *FileEntries, ch chan<- *FileEntries, wg *sync.WaitGroup) {
 	paths := parseExtendPaths(path, config)
 	wg.Add(len(paths))
+	columns := slices.Clone(parent.Columns) // 复制一份，避免与主词典共享
 	for _, extendPath := range paths {
 		go func(newPath string, id uint8) {
-			loadFromFile(newPath, id, columns, ch, wg)
+			loadFromFile(newPath, id, &columns, parent.CodeRule, true, ch, wg)
 		}(extendPath, util.IDGen.NextID())
 	}
 }
@@ -286,6 +399,19 @@ func parseYAML(raw []byte) (YAML, error) {
 	return config, err
 }
 
+// 将YAML的解析错误转换为 FileError，头部从文件的第一行开始，因此YAML中的行号即文件中的行号
+func headerError(path string, err error) error {
+	fe := &FileError{Op: "解析", Path: path, Err: fmt.Errorf("%w: %v", ErrInvalidHeader, err)}
+	var yamlErr yaml.Error
+	if errors.As(err, &yamlErr) {
+		if tk := yamlErr.GetToken(); tk != nil && tk.Position != nil {
+			fe.Line = tk.Position.Line
+		}
+		fe.Err = fmt.Errorf("%w: %s", ErrInvalidHeader, yamlErr.GetMessage())
+	}
+	return fe
+}
+
 func parseExtendPaths(path string, config *YAML) []string {
 	extends := make([]string, 0)
 	importTables := (*config)["import_tables"]
@@ -1,8 +1,11 @@
 package dict
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -57,7 +60,7 @@ func Test_LoadItems_xhup(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(_ *testing.T) {
 			// start := time.Now()
-			fes := LoadItems(tt.filename)
+			fes := mustLoadItems(tt.filename)
 			// duration1 := time.Since(start)
 			// fmt.Println("======================================================")
 			// fmt.Println("fes >>", len(fes))
@@ -105,7 +108,7 @@ func Test_LoadItems(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(_ *testing.T) {
 			// start := time.Now()
-			fes := LoadItems(tt.args.path)
+			fes := mustLoadItems(tt.args.path)
 			// duration1 := time.Since(start)
 			// fmt.Println("======================================================")
 			// fmt.Println("fes >>", len(fes))
@@ -328,3 +331,40 @@ func createFile(name string, content string) string {
 	_, _ = file.WriteString(content)
 	return file.Name()
 }
+
+func mustLoadItems(paths ...string) []*FileEntries {
+	fes, err := LoadItems(paths...)
+	if err != nil {
+		panic(err)
+	}
+	return fes
+}
+
+func Test_LoadItems_errors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := LoadItems(filepath.Join(dir, "missing.dict.yaml"))
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LoadItems() missing file error = %v, want FileError of fs.ErrNotExist", err)
+	}
+
+	path := filepath.Join(dir, "warn.dict.yaml")
+	content := "---\nname: warn\ncolumns: [text, code\n...\n# 注释\n123\t456\n你好\tnihao\n"
+	if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fes, err := LoadItems(path)
+	if err != nil {
+		t.Fatalf("LoadItems() error = %v", err)
+	}
+	warnings := fes[0].Warnings
+	if len(warnings) != 2 || !errors.Is(warnings[0], ErrInvalidHeader) || !errors.Is(warnings[1], ErrColumnAmbiguous) {
+		t.Fatalf("LoadItems() warnings = %v", warnings)
+	}
+	if !errors.As(warnings[1], &fileErr) || fileErr.Line != 6 {
+		t.Errorf("column warning line = %v, want 6", warnings[1])
+	}
+	if len(fes[0].Entries) != 2 {
+		t.Errorf("LoadItems() entries = %d, want 2", len(fes[0].Entries))
+	}
+}
@@ -2,6 +2,7 @@ package dict
 
 import (
 	"context"
+	"sync"
 
 	"github.com/sahilm/fuzzy"
 )
@@ -38,116 +39,141 @@ func (m *MatchResult) Cmp(other any) bool {
 	return false
 }
 
+// SearchItem 是搜索时项的快照，匹配在释放词典的锁之后进行，只读取快照中的内容
+type SearchItem struct {
+	Entry  *Entry
+	Target string // 用于匹配的内容，取决于搜索的列
+}
+
+// 搜索useColumn时用于匹配的内容，需持有词典的锁
+func searchTarget(entry *Entry, useColumn Column) string {
+	switch useColumn {
+	case COLUMN_CODE:
+		return entry.data.Code
+	case COLUMN_TEXT:
+		return entry.data.Text
+	default:
+		return entry.raw
+	}
+}
+
 type Matcher interface {
-	Search(key string, useColumn Column, searchVersion int, list []*Entry, resultChan chan<- MatchResultChunk, ctx context.Context)
+	// Search 在items中匹配key，将结果分批发送到resultChan，ctx取消后不再发送
+	Search(key string, useColumn Column, searchVersion int, items []SearchItem, resultChan chan<- MatchResultChunk, ctx context.Context)
 	Reset()
 }
 
+// 发送搜索结果，ctx取消时放弃发送，返回是否已发送
+func sendResult(ctx context.Context, resultChan chan<- MatchResultChunk, chunk MatchResultChunk) bool {
+	select {
+	case resultChan <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+type matchedItem struct {
+	item  SearchItem
+	score int
+}
+
 type CacheMatcher struct {
-	cache map[string][]*MatchResult
+	mu    sync.Mutex
+	cache map[string][]matchedItem
 }
 
 func (m *CacheMatcher) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.cache = nil
 }
 
+func (m *CacheMatcher) getCache(key string) []matchedItem {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cache[key]
+}
+
+func (m *CacheMatcher) setCache(key string, matched []matchedItem) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cache == nil {
+		m.cache = make(map[string][]matchedItem)
+	}
+	m.cache[key] = matched
+}
+
 // var slab = util.MakeSlab(200*1024, 4096)
 
-func (m *CacheMatcher) Search(key string, useColumn Column, searchVersion int, list []*Entry, resultChan chan<- MatchResultChunk, ctx context.Context) {
-	var done bool
-	go func() {
-		<-ctx.Done()
-		done = true
-	}()
-	var cache []*MatchResult
-	if m.cache != nil {
-		cachedKey := ""
-		for i := len(key); i > 0; i-- {
-			cachedKey = string(key[:i])
-			if cache = m.cache[cachedKey]; cache != nil {
-				break
-			}
+func (m *CacheMatcher) Search(key string, useColumn Column, searchVersion int, items []SearchItem, resultChan chan<- MatchResultChunk, ctx context.Context) {
+	// 不同列的匹配内容不同，缓存按列区分
+	prefix := string(useColumn) + "\x00"
+	var cache []matchedItem
+	cachedKey := ""
+	for i := len(key); i > 0; i-- {
+		cachedKey = key[:i]
+		if cache = m.getCache(prefix + cachedKey); cache != nil {
+			break
 		}
-		if done {
-			// log.Println("search canceld: ", key)
-			return
-		}
-		// if cache != nil {
-		// 	log.Println("search hit cache key: ", cachedKey)
-		// }
-		if cache != nil && cachedKey == string(key) {
-			// log.Println("search directly use cache")
-			resultChan <- MatchResultChunk{Result: cache, Version: searchVersion}
-			return
+	}
+	if ctx.Err() != nil {
+		// log.Println("search canceld: ", key)
+		return
+	}
+	if cache != nil && cachedKey == key {
+		// log.Println("search directly use cache")
+		ret := make([]*MatchResult, len(cache))
+		for i, c := range cache {
+			ret[i] = &MatchResult{c.item.Entry, c.score}
 		}
+		sendResult(ctx, resultChan, MatchResultChunk{Result: ret, Version: searchVersion})
+		return
 	}
 
 	if cache != nil {
-		list = make([]*Entry, len(cache))
+		items = make([]SearchItem, len(cache))
 		// log.Println("search from cached: ", key)
-		for i, m := range cache {
-			list[i] = m.Entry
+		for i, c := range cache {
+			items[i] = c.item
 		}
 	}
 
-	getTarget := func(entry *Entry) string {
-		return entry.data.Code
-	}
-	if useColumn != COLUMN_CODE {
-		if useColumn == COLUMN_TEXT {
-			getTarget = func(entry *Entry) string {
-				return entry.data.Text
-			}
-		} else {
-			getTarget = func(entry *Entry) string {
-				return entry.raw
-			}
-		}
-	}
-
-	matched := make([]*MatchResult, 0)
-	listLen := len(list)
+	matched := make([]matchedItem, 0)
+	listLen := len(items)
 	chunkSize := 50000 // chunkSize = listLen means no async search
 	for c := 0; c < listLen; c += chunkSize {
 		end := min(c+chunkSize, listLen)
-		chunk := list[c:end]
-		source := &ChunkSource{chunk, getTarget}
-		matches := fuzzy.FindFromNoSort(key, source)
+		chunk := items[c:end]
+		matches := fuzzy.FindFromNoSort(key, ChunkSource(chunk))
 		if len(matches) == 0 {
 			// log.Println("search zero matches: ", key)
-			resultChan <- MatchResultChunk{Result: []*MatchResult{}, Version: searchVersion}
+			if !sendResult(ctx, resultChan, MatchResultChunk{Result: []*MatchResult{}, Version: searchVersion}) {
+				return
+			}
 			continue
 		}
 		ret := make([]*MatchResult, 0, len(matches))
 		for _, ma := range matches {
-			if chunk[ma.Index].IsDelete() { // cache matcher still need to determine whether it has been deleted
-				continue
-			}
-			ret = append(ret, &MatchResult{chunk[ma.Index], ma.Score})
+			matched = append(matched, matchedItem{chunk[ma.Index], ma.Score})
+			ret = append(ret, &MatchResult{chunk[ma.Index].Entry, ma.Score})
 		}
-		if len(ret) > 0 {
-			resultChan <- MatchResultChunk{Result: ret, Version: searchVersion}
-			matched = append(matched, ret...)
+		if !sendResult(ctx, resultChan, MatchResultChunk{Result: ret, Version: searchVersion}) {
+			return
 		}
 	}
 	// log.Printf("Cache Matcher Search: Key: %s, List Len: %d, Cached: %v, Matched: %d", string(key), listLen, cache != nil, len(matched))
 	if len(matched) > 0 {
-		if m.cache == nil {
-			m.cache = make(map[string][]*MatchResult)
-		}
-		m.cache[key] = matched
+		m.setCache(prefix+key, matched)
 	}
 }
 
-type ChunkSource struct {
-	chunk     []*Entry
-	getTarget func(e *Entry) string
-}
+type ChunkSource []SearchItem
 
-func (e *ChunkSource) Len() int {
-	return len(e.chunk)
+func (e ChunkSource) Len() int {
+	return len(e)
 }
 
-func (e *ChunkSource) String(i int) string {
-	return e.getTarget(e.chunk[i])
+func (e ChunkSource) String(i int) string {
+	return e[i].Target
 }
@@ -1,9 +1,13 @@
 package dict
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"math"
 	"os"
+	"slices"
 	"sort"
 	"sync"
 )
@@ -30,20 +34,22 @@ func isExtendedCJK(text string) bool {
 	return false
 }
 
-func exportDict(path string, fes []*FileEntries, cols []Column, sortByWeight bool) {
+func exportDict(path string, fes []*FileEntries, cols []Column, sortByWeight bool) (err error) {
 	var file *os.File
 	if path == "stdout" {
 		file = os.Stdout
 	} else {
 		file_, err := os.Create(path)
 		if err != nil {
-			panic(err)
+			return fileError("导出", path, err)
 		}
 		file = file_
+		defer func() {
+			if cerr := file.Close(); err == nil {
+				err = fileError("导出", path, cerr)
+			}
+		}()
 	}
-	defer func() {
-		_ = file.Close()
-	}()
 	entries := make([]*Entry, 0)
 	for _, fe := range fes {
 		if len(fe.Entries) == 0 {
@@ -57,88 +63,154 @@ func exportDict(path string, fes []*FileEntries, cols []Column, sortByWeight boo
 		})
 	}
 	for _, entry := range entries {
-		log.Println("导出词库中:", path)
 		if isExtendedCJK(entry.data.Text) {
 			continue
 		}
-		_, err := file.WriteString(entry.data.ToStringWithColumns(&cols))
-		if err != nil {
-			panic(err)
-		}
-		_, err = file.WriteString("\n")
-		if err != nil {
-			panic(err)
+		if _, err := file.WriteString(entry.data.ToStringWithColumns(&cols) + "\n"); err != nil {
+			return fileError("导出", path, err)
 		}
 	}
+	return nil
 }
 
-func output(fes []*FileEntries) (changed bool) {
+// 将所有文件的变更写入文件，返回按文件顺序排列的变更，以及所有写入失败的错误。
+// 各文件独立写入(原地写入以保留链接与权限)，部分文件失败时其余文件仍会写入，返回的变更只包含已写入的文件，
+// 失败文件的变更仍在内存中，可在问题解决后重试。
+// ctx取消后不再开始写入其余的文件，已开始写入的文件会写完；被其他程序修改过的文件不写入
+func output(ctx context.Context, fes []*FileEntries) ([]Change, error) {
 	var wg sync.WaitGroup
-	for _, fe := range fes {
-		if len(fe.Entries) == 0 {
+	fileChanges := make([][]Change, len(fes))
+	errs := make([]error, len(fes))
+	var ctxErr error
+	for i, fe := range fes {
+		if len(fe.Entries) == 0 || fe.Readonly {
 			continue
 		}
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			break
+		}
 		wg.Add(1)
-		go func(fe *FileEntries) {
+		go func(i int, fe *FileEntries) {
 			defer wg.Done()
 			sort.Slice(fe.Entries, func(i, j int) bool {
 				return fe.Entries[i].seek < fe.Entries[j].seek
 			})
-			if outputFile(&fe.RawBs, fe.FilePath, fe.Entries) {
-				changed = true
+			if !fe.unsaved() {
+				return
+			}
+			if fe.modifiedOutside() {
+				errs[i] = fileError("写入", fe.FilePath, ErrModifiedOutside)
+				return
+			}
+			fileChanges[i], errs[i] = outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
+			if errs[i] == nil {
+				fe.restamp()
 			}
-		}(fe)
+		}(i, fe)
 	}
 	wg.Wait()
-	return changed
+	return slices.Concat(fileChanges...), errors.Join(append(errs, ctxErr)...)
 }
 
-func tryPanic(err error, format string, args ...any) {
+// 将变更写入文件，写入成功后才将变更标记为已写入，失败(如没有权限、磁盘已满)时可在问题解决后重试
+func outputFile(rawBs *[]byte, path string, entries []*Entry, policy InsertPolicy) ([]Change, error) {
+	if !slices.ContainsFunc(entries, func(e *Entry) bool { return e.modType != NC }) {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		return nil, fileError("写入", path, err)
+	}
+	defer func() { _ = file.Close() }()
+	bs, changes, states := applyEntries(*rawBs, entries, policy)
+	l, err := file.Write(bs)
+	if err == nil {
+		err = file.Truncate(int64(l))
+	}
 	if err != nil {
-		panic(fmt.Sprintf(format, args...))
+		return nil, fileError("写入", path, err)
+	}
+	for i := range changes {
+		changes[i].FilePath = path
 	}
+	saveEntries(states)
+	*rawBs = bs
+	return changes, nil
 }
 
-func outputFile(rawBs *[]byte, path string, entries []*Entry) (changed bool) {
-	file, err := os.OpenFile(path, os.O_RDWR, 0666)
-	tryPanic(err, "open File failed, Err:%v", err)
-	defer func() { _ = file.Close() }()
-	bs := *rawBs
+// 将entries的变更(按seek排序)应用到码表的原始内容bs上，返回变更后的内容、变更记录(不包括文件路径，
+// 也不包括改回了原内容的修改)，以及写入后各项的位置。不会修改bs与entries，写入成功后通过 saveEntries 更新各项
+func applyEntries(bs []byte, entries []*Entry, policy InsertPolicy) (_ []byte, changes []Change, states []entryState) {
+	bs = slices.Clone(bs)
 	willAddEntries := make([]*Entry, 0)
+	// 插入到文件中间的新增项，按插入位置(原始内容中的偏移)排列
+	inserts := make([]insertion, 0)
+	inserted := make(map[*Entry]bool)
+	if policy == INSERT_BY_CODE {
+		index := newInsertIndex(entries)
+		for _, entry := range entries {
+			if entry.modType != ADD || entry.data.Code == "" {
+				continue
+			}
+			if at := index.offset(entry.data.Code); at < int64(len(bs)) {
+				inserts = append(inserts, insertion{entry, at})
+				inserted[entry] = true
+			}
+		}
+		sort.SliceStable(inserts, func(i, j int) bool { return inserts[i].at < inserts[j].at })
+	}
 	seekFixed := int64(0)
+	insert := func(before int64) {
+		for len(inserts) > 0 && inserts[0].at <= before {
+			entry, at := inserts[0].entry, inserts[0].at+seekFixed
+			nbs := append([]byte(entry.Raw()), '\n')
+			bs = append(bs[:at], append(nbs, bs[at:]...)...)
+			states = append(states, entryState{entry, at, int64(len(nbs)), true})
+			seekFixed += int64(len(nbs))
+			inserts = inserts[1:]
+		}
+	}
 	for _, entry := range entries {
-		entry.seek += seekFixed
+		if entry.modType != ADD {
+			insert(entry.seek)
+		}
+		seek := entry.seek + seekFixed
 		if entry.modType == NC {
+			states = append(states, entryState{entry, seek, entry.rawSize, false})
 			continue
 		}
-		var modType string
+		change := Change{Raw: entry.Raw()}
 		switch entry.modType {
 		case DELETE:
-			bs = append(bs[:entry.seek], bs[entry.seek+entry.rawSize:]...)
+			bs = append(bs[:seek], bs[seek+entry.rawSize:]...)
 			seekFixed = seekFixed - entry.rawSize
-			entry.Saved()
-			modType = "DEL"
+			change.Type, change.Raw = CHANGE_DEL, entry.saved
+			states = append(states, entryState{entry, seek, entry.rawSize, true})
 		case MODIFY:
 			nbs := []byte(entry.Raw())
 			nbs = append(nbs, '\n')
-			bs = append(bs[:entry.seek], append(nbs, bs[entry.seek+entry.rawSize:]...)...)
+			bs = append(bs[:seek], append(nbs, bs[seek+entry.rawSize:]...)...)
 			seekFixed = seekFixed - entry.rawSize + int64(len(nbs))
-			entry.Saved()
-			modType = "MOD"
+			states = append(states, entryState{entry, seek, int64(len(nbs)), true})
+			modified, changed := entry.modifyChange()
+			if !changed {
+				continue
+			}
+			change = modified
 		case ADD:
-			willAddEntries = append(willAddEntries, entry)
-			modType = "ADD"
+			if !inserted[entry] {
+				willAddEntries = append(willAddEntries, entry)
+			}
+			change.Type = CHANGE_ADD
 		}
-		log.Printf("modify dict type:%s | %s", modType, entry.Raw())
-		changed = true
-	}
-	if !changed {
-		return
+		slog.Debug("modify dict", "change", change)
+		changes = append(changes, change)
 	}
+	insert(math.MaxInt64)
 	seek := int64(len(bs))
 	// append new entry to file
 	if len(willAddEntries) > 0 {
-		if bs[len(bs)-1] != '\n' {
+		if len(bs) > 0 && bs[len(bs)-1] != '\n' {
 			bs = append(bs, '\n')
 			seek += 1
 		}
@@ -147,15 +219,121 @@ func outputFile(rawBs *[]byte, path string, entries []*Entry) (changed bool) {
 			rawSize := int64(len(raw) + 1)
 			bs = append(bs, raw...)
 			bs = append(bs, '\n')
-			entry.reSeek(seek, rawSize)
-			entry.Saved()
-			seek += entry.rawSize
+			states = append(states, entryState{entry, seek, rawSize, true})
+			seek += rawSize
 		}
 	}
-	*rawBs = bs
-	l, err := file.Write(bs)
-	tryPanic(err, "write File failed, Err:%v", err)
-	err = file.Truncate(int64(l))
-	tryPanic(err, "truncate File failed, Err:%v", err)
-	return
+	return bs, changes, states
+}
+
+// 写入后项在文件中的位置，saved 表示此项的变更已写入
+type entryState struct {
+	entry   *Entry
+	seek    int64
+	rawSize int64
+	saved   bool
+}
+
+// 写入文件后更新各项的位置，并将已写入的项标记为未修改
+func saveEntries(states []entryState) {
+	for _, s := range states {
+		s.entry.reSeek(s.seek, s.rawSize)
+		if s.saved {
+			s.entry.Saved()
+		}
+	}
+}
+
+// 将entry在原始内容中所在的行移动到偏移at处(移动前的偏移)，并修正其他项的位置。
+// 原始内容在写入文件前即已改变，因此将entry标记为修改，使下次写入时写入整个文件
+func (fe *FileEntries) moveLine(entry *Entry, at int64) {
+	bs := fe.RawBs
+	from, size := entry.seek, entry.rawSize
+	line := slices.Clone(bs[from : from+size])
+	if line[len(line)-1] != '\n' { // 文件的最后一行没有换行符
+		line = append(line, '\n')
+	}
+	bs = slices.Delete(bs, int(from), int(from+size))
+	if at > from {
+		at -= size
+	}
+	for _, e := range fe.Entries {
+		if e != entry && e.seek >= from+size {
+			e.seek -= size
+		}
+	}
+	if at == int64(len(bs)) && len(bs) > 0 && bs[len(bs)-1] != '\n' {
+		bs = append(bs, '\n')
+		for _, e := range fe.Entries {
+			if e != entry && !e.IsDelete() && e.seek+e.rawSize == at {
+				e.rawSize++
+			}
+		}
+		at++
+	}
+	bs = slices.Insert(bs, int(at), line...)
+	for _, e := range fe.Entries {
+		if e != entry && e.seek >= at {
+			e.seek += int64(len(line))
+		}
+	}
+	entry.reSeek(at, int64(len(line)))
+	fe.RawBs = bs
+	entry.moved = true
+	if entry.modType == NC {
+		entry.modType = MODIFY
+	}
+}
+
+type insertion struct {
+	entry *Entry
+	at    int64
+}
+
+// 按编码插入新增项时，查找插入位置的索引
+type insertIndex struct {
+	last  map[string]*Entry // 每个编码在文件中的最后一项
+	codes []string          // 已排序的编码
+	upTo  []*Entry          // upTo[i]为编码不大于codes[i]的项中在文件中的最后一项
+	first *Entry            // 文件中的第一项
+}
+
+func newInsertIndex(entries []*Entry) *insertIndex {
+	index := &insertIndex{last: make(map[string]*Entry)}
+	for _, e := range entries {
+		if e.modType == ADD || e.IsDelete() {
+			continue
+		}
+		if last, ok := index.last[e.data.Code]; !ok || e.seek > last.seek {
+			index.last[e.data.Code] = e
+		}
+		if index.first == nil || e.seek < index.first.seek {
+			index.first = e
+		}
+	}
+	index.codes = slices.Sorted(maps.Keys(index.last))
+	index.upTo = make([]*Entry, len(index.codes))
+	for i, code := range index.codes {
+		index.upTo[i] = index.last[code]
+		if i > 0 && index.upTo[i-1].seek > index.upTo[i].seek {
+			index.upTo[i] = index.upTo[i-1]
+		}
+	}
+	return index
+}
+
+// 编码为code的新增项在原始内容中的插入位置：编码相同的最后一项之后，没有时为编码更小的项中最后一项之后，
+// 都没有时为第一项之前；文件中没有项时返回math.MaxInt64，即追加到文件末尾
+func (index *insertIndex) offset(code string) int64 {
+	if e, ok := index.last[code]; ok {
+		return e.seek + e.rawSize
+	}
+	if i, _ := slices.BinarySearch(index.codes, code); i > 0 {
+		e := index.upTo[i-1]
+		return e.seek + e.rawSize
+	}
+	if index.first != nil {
+		return index.first.seek
+	}
+	return math.MaxInt64
 }
@@ -1,7 +1,12 @@
 package dict
 
 import (
+	"context"
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 )
 
@@ -119,7 +124,7 @@ columns:
 			name: "delete some 1",
 			fe: func() *FileEntries {
 				filename := createFile("./tmp/test_outputfile1.yaml", content1)
-				fe := LoadItems(filename)[0]
+				fe := mustLoadItems(filename)[0]
 				fe.Entries[0].Delete()
 				return fe
 			}(),
@@ -131,9 +136,9 @@ columns:
 			name: "delete some 2",
 			fe: func() *FileEntries {
 				filename := createFile("./tmp/test_outputfile2.yaml", content1)
-				fe := LoadItems(filename)[0]
+				fe := mustLoadItems(filename)[0]
 				fe.Entries[0].Delete()
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				fe.Entries[2].Delete()
 				return fe
 			}(),
@@ -145,7 +150,7 @@ columns:
 			name: "delete 1 mod 2",
 			fe: func() *FileEntries {
 				filename := createFile("./tmp/test_outputfile3.yaml", content1)
-				fe := LoadItems(filename)[0]
+				fe := mustLoadItems(filename)[0]
 				fe.Entries[0].Delete()
 				fe.Entries[1].ReRaw("早早\tzaozao")
 				fe.Entries[2].ReRaw("测试\tceshi")
@@ -159,13 +164,13 @@ columns:
 			name: "delete 1 mod 2 output multiple times",
 			fe: func() *FileEntries {
 				filename := createFile("./tmp/test_outputfile4.yaml", content1)
-				fe := LoadItems(filename)[0]
+				fe := mustLoadItems(filename)[0]
 				fe.Entries[0].Delete()
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				fe.Entries[1].ReRaw("早早\tzaozao")
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				fe.Entries[2].ReRaw("测试\tceshi")
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				return fe
 			}(),
 			want:          content1_want3,
@@ -176,11 +181,11 @@ columns:
 			name: "delete and output multiple times",
 			fe: func() *FileEntries {
 				filename := createFile("./tmp/test_outputfile5.yaml", content1)
-				fe := LoadItems(filename)[0]
+				fe := mustLoadItems(filename)[0]
 				fe.Entries[0].Delete()
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				fe.Entries[2].Delete()
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				return fe
 			}(),
 			want:          content1_want2,
@@ -191,12 +196,12 @@ columns:
 			name: "content2",
 			fe: func() *FileEntries {
 				filename := createFile("./tmp/test_outputfile6.yaml", content2)
-				fe := LoadItems(filename)[0]
+				fe := mustLoadItems(filename)[0]
 				fe.Entries[0].Delete()
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 
 				fe.Entries[2].Delete()
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 
 				return fe
 			}(),
@@ -208,11 +213,11 @@ columns:
 			name: "content3",
 			fe: func() *FileEntries {
 				filename := createFile("./tmp/test_outputfile7.yaml", content3)
-				fe := LoadItems(filename)[0]
+				fe := mustLoadItems(filename)[0]
 				fe.Entries[0].Delete()
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				fe.Entries[2].Delete()
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				return fe
 			}(),
 			want:          content3_want1,
@@ -223,26 +228,26 @@ columns:
 			name: "add and modify",
 			fe: func() *FileEntries {
 				filename := createFile("./tmp/test_outputfile8.yaml", content4)
-				fe := LoadItems(filename)[0]
+				fe := mustLoadItems(filename)[0]
 
 				// new entry then just delete
 				ne0 := NewEntryAdd("萌子	lohi	1", 0, Data{cols: &fe.Columns})
 				fe.Entries = append(fe.Entries, ne0)
-				// outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				// outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				ne0.Delete()
 
 				ne1 := NewEntryAdd("萌子	lohi	1", 0, Data{cols: &fe.Columns})
 				fe.Entries = append(fe.Entries, ne1)
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				ne1.Delete()
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				ne2 := NewEntryAdd("伊藤	jblv	1", 0, Data{cols: &fe.Columns})
 				fe.Entries = append(fe.Entries, ne2)
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				ne2.ReRaw("伊藤	jblv	10")
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				ne2.ReRaw("伊藤萌子	jllh	10")
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				return fe
 			}(),
 			want:          content4_want1,
@@ -253,14 +258,14 @@ columns:
 			name: "delete and save and delete again",
 			fe: func() *FileEntries {
 				filename := createFile("./tmp/test_outputfile9.yaml", content4)
-				fe := LoadItems(filename)[0]
+				fe := mustLoadItems(filename)[0]
 				de := fe.Entries[1]
 				d1 := fe.Entries[2]
 				d1.ReRaw("测	ceek	10")
 				de.Delete()
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				de.Delete()
-				outputFile(&fe.RawBs, fe.FilePath, fe.Entries)
+				outputFile(&fe.RawBs, fe.FilePath, fe.Entries, fe.InsertPolicy)
 				return fe
 			}(),
 			want:          content4_want2,
@@ -271,7 +276,11 @@ columns:
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(_ *testing.T) {
-			changed := outputFile(&tt.fe.RawBs, tt.fe.FilePath, tt.fe.Entries)
+			changes, err := outputFile(&tt.fe.RawBs, tt.fe.FilePath, tt.fe.Entries, tt.fe.InsertPolicy)
+			if err != nil {
+				panic(err)
+			}
+			changed := len(changes) > 0
 			c, err := os.ReadFile(tt.filename)
 			if err != nil {
 				panic(err)
@@ -288,3 +297,191 @@ columns:
 		})
 	}
 }
+
+func Test_Dictionary_Save_canceled(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/a.dict.yaml"
+	content := "---\nname: a\n...\n你好\tnau\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := Open([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range dc.Find("你好", "nau") {
+		if err := dc.Update(entry, func(data *Data) { data.Code = "nh" }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := dc.Save(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Save() with canceled context error = %v, want context.Canceled", err)
+	}
+	if bs, _ := os.ReadFile(path); string(bs) != content {
+		t.Fatalf("Save() with canceled context wrote file: %q", bs)
+	}
+	changes, err := dc.Save(context.Background())
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("Save() = %v, %v, want 1 change", changes, err)
+	}
+	if bs, _ := os.ReadFile(path); string(bs) != "---\nname: a\n...\n你好\tnh\n" {
+		t.Fatalf("Save() wrote %q", bs)
+	}
+}
+
+// 写入失败时变更仍未写入，问题解决后可重试
+func Test_Dictionary_Save_writeFailed(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full not available")
+	}
+	path := filepath.Join(t.TempDir(), "a.dict.yaml")
+	if err := os.WriteFile(path, []byte("---\nname: a\n...\n你好\tnau\n再见\tzj\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := Open([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Update(dc.Find("你好", "nau")[0], func(data *Data) { data.Code = "nh" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Delete(dc.Find("再见", "zj")[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Add(NewEntryAdd("早\tz", dc.fileEntries[0].ID, Data{Text: "早", Code: "z"})); err != nil {
+		t.Fatal(err)
+	}
+	fe := dc.fileEntries[0]
+	stamp := fe.stamp
+	fe.FilePath, fe.stamp = "/dev/full", fileStamp{} // 可以打开，写入时返回 ENOSPC
+	if changes, err := dc.Save(context.Background()); !errors.Is(err, syscall.ENOSPC) || len(changes) != 0 {
+		t.Fatalf("Save() to a full disk = %v, %v, want ENOSPC", changes, err)
+	}
+	if pending := dc.Pending(); len(pending) != 3 {
+		t.Fatalf("Pending() after failed write = %v", pending)
+	}
+	fe.FilePath, fe.stamp = path, stamp
+	changes, err := dc.Save(context.Background())
+	if err != nil || len(changes) != 3 {
+		t.Fatalf("Save() retry = %v, %v", changes, err)
+	}
+	if bs, _ := os.ReadFile(path); string(bs) != "---\nname: a\n...\n你好\tnh\n早\tz\n" {
+		t.Errorf("Save() retry wrote %q", bs)
+	}
+}
+
+func Test_Dictionary_readonly(t *testing.T) {
+	dir := t.TempDir()
+	content := "---\nname: a\n...\n你好\tnau\t1\n"
+	for _, name := range []string{"a.dict.yaml", "b.dict.yaml"} {
+		if err := os.WriteFile(dir+"/"+name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc, err := Open([]string{dir + "/a.dict.yaml", dir + "/b.dict.yaml"}, &OpenOptions{ReadonlyPaths: []string{dir + "/b.*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a, b *FileEntries
+	for fe := range dc.Files() {
+		if fe.Readonly {
+			b = fe
+		} else {
+			a = fe
+		}
+	}
+	if a == nil || b == nil || !strings.HasSuffix(b.FilePath, "b.dict.yaml") {
+		t.Fatalf("SetReadonly() a = %v, b = %v", a, b)
+	}
+	entry := dc.FileEntries(b)[0]
+	if err := dc.Delete(entry); !errors.Is(err, ErrReadonly) {
+		t.Errorf("Delete() error = %v, want ErrReadonly", err)
+	}
+	if err := dc.ReRaw(entry, "你好\tnau\t2"); !errors.Is(err, ErrReadonly) {
+		t.Errorf("ReRaw() error = %v, want ErrReadonly", err)
+	}
+	if _, err := dc.Insert(b, Data{Text: "再见", Code: "zj"}); !errors.Is(err, ErrReadonly) {
+		t.Errorf("Insert() error = %v, want ErrReadonly", err)
+	}
+	if batch := dc.ClampWeights(dc.Entries(), 5, 0); batch == nil || batch.Len() != 1 {
+		t.Fatalf("ClampWeights() should only change the writable file, got %v", batch)
+	}
+	if _, err := dc.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := os.ReadFile(dir + "/a.dict.yaml"); string(bs) != "---\nname: a\n...\n你好\tnau\t5\n" {
+		t.Errorf("writable file = %q", bs)
+	}
+	if bs, _ := os.ReadFile(dir + "/b.dict.yaml"); string(bs) != content {
+		t.Errorf("readonly file was written: %q", bs)
+	}
+}
+
+func Test_Dictionary_Save_insertByCode(t *testing.T) {
+	dir := t.TempDir()
+	content := "---\nname: a\nsort: original\n...\n# 注释\n阿\ta\n啊\ta\n你\tni\n# 注释\n他\tta\n"
+	writeFiles(t, dir, map[string]string{"a.dict.yaml": content, "b.dict.yaml": strings.Replace(content, "sort: original\n", "", 1)})
+	for name, want := range map[string]string{
+		"a.dict.yaml": "---\nname: a\nsort: original\n...\n# 注释\n阿\ta\n啊\ta\n吖\ta\n八\tba\n你\tni\n呢\tni\n# 注释\n他\tta\n哇\twa\n",
+		"b.dict.yaml": "---\nname: a\n...\n# 注释\n阿\ta\n啊\ta\n你\tni\n# 注释\n他\tta\n呢\tni\n吖\ta\n八\tba\n哇\twa\n",
+	} {
+		path := filepath.Join(dir, name)
+		dc, err := Open([]string{path}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fe := dc.fileEntries[0]
+		for _, data := range []Data{{Text: "呢", Code: "ni"}, {Text: "吖", Code: "a"}, {Text: "八", Code: "ba"}, {Text: "哇", Code: "wa"}} {
+			if _, err := dc.Insert(fe, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := dc.Save(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if bs, _ := os.ReadFile(path); string(bs) != want {
+			t.Errorf("Save() %s = %q, want %q", name, bs, want)
+		}
+		// 插入后的位置正确，之后的修改写入正确的行
+		if err := dc.Update(dc.Find("八", "")[0], func(data *Data) { data.Code = "bb" }); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dc.Save(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if bs, _ := os.ReadFile(path); string(bs) != strings.Replace(want, "八\tba", "八\tbb", 1) {
+			t.Errorf("Save() again %s = %q", name, bs)
+		}
+	}
+}
+
+// 文件被其他程序修改后不写入，避免覆盖其中的修改
+func Test_Dictionary_Save_modifiedOutside(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.dict.yaml")
+	if err := os.WriteFile(path, []byte("你好\tnau\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := Open([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Delete(dc.Find("你好", "")[0]); err != nil {
+		t.Fatal(err)
+	}
+	outside := "你好\tnau\n再见\tzj\n"
+	if err := os.WriteFile(path, []byte(outside), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Save(context.Background()); !errors.Is(err, ErrModifiedOutside) {
+		t.Errorf("Save() error = %v, want %v", err, ErrModifiedOutside)
+	}
+	if bs, _ := os.ReadFile(path); string(bs) != outside {
+		t.Errorf("file = %q, want %q", bs, outside)
+	}
+	// 有未写入的修改时不重新读取
+	if reloaded, err := dc.Reload(); err != nil || len(reloaded) != 0 || len(dc.Pending()) != 1 {
+		t.Errorf("Reload() with pending changes = %v, %v", reloaded, err)
+	}
+}
@@ -0,0 +1,311 @@
+package dict
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// PatchType 是变更文件中每行的操作
+type PatchType byte
+
+const (
+	PATCH_ADD    PatchType = '+' // 添加，如 + 你好	nau	10
+	PATCH_DELETE PatchType = '-' // 删除，如 - 你好	nau
+	PATCH_MODIFY PatchType = '~' // 修改列，如 ~ 你好	nau weight=20
+	PATCH_MOVE   PatchType = '>' // 移动到其他文件，如 > 你好	nau file=user
+)
+
+// PatchOp 是变更文件中的一行
+type PatchOp struct {
+	Line int
+	Type PatchType
+	// 字词、编码与权重，以制表符或空格分隔
+	Entry string
+	// 行尾 名称=值 形式的参数，名称为列名或file，值包含空白时以双引号包围
+	Args map[string]string
+}
+
+// PatchError 是变更文件中某一行无法解析或应用的错误
+type PatchError struct {
+	Line int
+	Err  error
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("第%d行: %v", e.Line, e.Err)
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// 变更文件中的项未找到
+	ErrPatchNotFound = errors.New("未找到此项")
+	// 变更文件中的项匹配到多个，需通过权重或file=限定
+	ErrPatchAmbiguous = errors.New("匹配到多个项，可通过权重或file=限定")
+	// file=指定的文件未加载
+	ErrPatchFile = errors.New("未找到指定的文件")
+)
+
+// ParsePatch 解析变更文件，忽略空行与#开头的注释
+func ParsePatch(r io.Reader) ([]PatchOp, error) {
+	ops := make([]PatchOp, 0)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		op := PatchOp{Line: line, Type: PatchType(text[0])}
+		switch op.Type {
+		case PATCH_ADD, PATCH_DELETE, PATCH_MODIFY, PATCH_MOVE:
+		default:
+			return nil, &PatchError{line, fmt.Errorf("未知的操作 %q，应为 + - ~ >", text[0])}
+		}
+		body := text[1:]
+		fields := splitFields(body)
+		// 行尾的 名称=值 为参数，其前为原样保留的项
+		i := len(fields)
+		for i > 0 && fields[i-1].arg {
+			i--
+		}
+		for _, field := range fields[i:] {
+			if op.Args == nil {
+				op.Args = make(map[string]string)
+			}
+			op.Args[field.name] = field.value
+		}
+		if i < len(fields) {
+			body = body[:fields[i].start]
+		}
+		op.Entry = strings.TrimSpace(body)
+		if op.Entry == "" {
+			return nil, &PatchError{line, errors.New("缺少字词与编码")}
+		}
+		if op.Type == PATCH_MOVE && op.Args["file"] == "" {
+			return nil, &PatchError{line, errors.New("移动需通过file=指定目标文件")}
+		}
+		ops = append(ops, op)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// ApplyPatch 依次应用变更，file=user 表示用户词典userPath。
+// 任意一行失败时撤销此前的所有变更并返回错误，成功时返回可通过 Undo 撤销的批量修改
+func (d *Dictionary) ApplyPatch(ops []PatchOp, userPath string) (*Batch, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b := &Batch{Name: "应用变更文件"}
+	for _, op := range ops {
+		if err := d.applyPatchOp(b, op, userPath); err != nil {
+			b.undo()
+			return nil, &PatchError{op.Line, err}
+		}
+	}
+	return d.commit(b), nil
+}
+
+func (d *Dictionary) applyPatchOp(b *Batch, op PatchOp, userPath string) error {
+	var target *FileEntries
+	if name, ok := op.Args["file"]; ok {
+		target = d.patchFile(name, userPath)
+		if target == nil {
+			return fmt.Errorf("%w: %s", ErrPatchFile, name)
+		}
+	}
+	if op.Type == PATCH_ADD {
+		if target == nil {
+			target = d.patchFile("user", userPath)
+		}
+		if target == nil {
+			target = d.fileEntries[0]
+		}
+		return d.patchAdd(b, target, op)
+	}
+	source := target
+	if op.Type == PATCH_MOVE {
+		source = nil
+	}
+	entry, err := d.patchFind(op.Entry, source)
+	if err != nil {
+		return err
+	}
+	if d.readonly(entry) {
+		return ErrReadonly
+	}
+	switch op.Type {
+	case PATCH_DELETE:
+		b.delete(entry)
+	case PATCH_MODIFY:
+		data := entry.data
+		if err := setPatchArgs(&data, op.Args, *data.cols); err != nil {
+			return err
+		}
+		b.reRaw(entry, data.ToString())
+	case PATCH_MOVE:
+		if target.ID == entry.FID {
+			return nil
+		}
+		if target.Readonly {
+			return ErrReadonly
+		}
+		patchColumns(b, target)
+		data := entry.data
+		data.ResetColumns(&target.Columns)
+		if d.patchExists(target, data.Text, data.Code) {
+			return fmt.Errorf("%w: %s", ErrDuplicate, filepath.Base(target.FilePath))
+		}
+		b.delete(entry)
+		raw := data.ToString()
+		added := NewEntryAdd(raw, target.ID, fastParseData(raw, &target.Columns))
+		d.add(added)
+		b.added = append(b.added, added)
+	}
+	return nil
+}
+
+func (d *Dictionary) patchAdd(b *Batch, fe *FileEntries, op PatchOp) error {
+	if fe.Readonly {
+		return ErrReadonly
+	}
+	patchColumns(b, fe)
+	data, _, err := parsePatchEntry(op.Entry, slices.Contains(fe.Columns, COLUMN_STEM))
+	if err != nil {
+		return err
+	}
+	if err := setPatchArgs(&data, op.Args, fe.Columns); err != nil {
+		return err
+	}
+	if data.Text == "" || data.Code == "" {
+		return errors.New("缺少字词或编码")
+	}
+	if d.patchExists(fe, data.Text, data.Code) {
+		return fmt.Errorf("%w: %s", ErrDuplicate, filepath.Base(fe.FilePath))
+	}
+	data.ResetColumns(&fe.Columns)
+	raw := data.ToString()
+	entry := NewEntryAdd(raw, fe.ID, fastParseData(raw, &fe.Columns))
+	d.add(entry)
+	b.added = append(b.added, entry)
+	return nil
+}
+
+// 按 字词+编码(+权重) 查找唯一的项，fe不为nil时只在fe中查找
+func (d *Dictionary) patchFind(spec string, fe *FileEntries) (*Entry, error) {
+	data, cols, err := parsePatchEntry(spec, false)
+	if err != nil {
+		return nil, err
+	}
+	weight := slices.Contains(cols, COLUMN_WEIGHT)
+	var found *Entry
+	for _, entry := range d.entries {
+		if entry.IsDelete() || (fe != nil && entry.FID != fe.ID) {
+			continue
+		}
+		if entry.data.Text != data.Text || entry.data.Code != data.Code {
+			continue
+		}
+		if weight && entry.data.Weight != data.Weight {
+			continue
+		}
+		if found != nil {
+			return nil, ErrPatchAmbiguous
+		}
+		found = entry
+	}
+	if found == nil {
+		return nil, ErrPatchNotFound
+	}
+	return found, nil
+}
+
+// 解析变更文件中的项：包含制表符时与码表相同，依次为字词、编码、权重(、造词码)，字词可以包含空格；
+// 否则以空格分隔，与Tui中的输入相同，如 你好 nau 10
+func parsePatchEntry(spec string, hasStem bool) (Data, []Column, error) {
+	if !strings.Contains(spec, "\t") {
+		pair, cols := ParseInput(spec, hasStem)
+		data, err := ParseData(pair, &cols)
+		return data, cols, err
+	}
+	order := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	if hasStem {
+		order = append(order, COLUMN_STEM)
+	}
+	split := strings.Split(spec, "\t")
+	if len(split) > len(order) {
+		return Data{}, nil, fmt.Errorf("多余的列: %s", strings.Join(split[len(order):], " "))
+	}
+	pair, cols := make([]string, 0, len(split)), make([]Column, 0, len(split))
+	for i, value := range split {
+		value = strings.TrimSpace(value)
+		if value == "" && (order[i] == COLUMN_WEIGHT || order[i] == COLUMN_STEM) {
+			continue
+		}
+		if err := order[i].Check(value); err != nil {
+			return Data{}, nil, err
+		}
+		pair, cols = append(pair, value), append(cols, order[i])
+	}
+	data, err := ParseData(pair, &cols)
+	return data, cols, err
+}
+
+// 空文件没有列序时使用默认的列序 [字词 编码 权重]
+func patchColumns(b *Batch, fe *FileEntries) {
+	if len(fe.Columns) == 0 {
+		b.keepColumns(fe)
+		fe.Columns = []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	}
+}
+
+func (d *Dictionary) patchExists(fe *FileEntries, text, code string) bool {
+	return slices.ContainsFunc(fe.Entries, func(entry *Entry) bool {
+		return !entry.IsDelete() && entry.data.Text == text && entry.data.Code == code
+	})
+}
+
+// 按文件名(可省略.dict.yaml)或码表名查找文件，user表示用户词典
+func (d *Dictionary) patchFile(name, userPath string) *FileEntries {
+	for _, fe := range d.fileEntries {
+		if name == "user" {
+			if userPath != "" && filepath.Clean(fe.FilePath) == filepath.Clean(userPath) {
+				return fe
+			}
+			continue
+		}
+		if name == filepath.Base(fe.FilePath) || name == dictName(fe.FilePath, nil) {
+			return fe
+		}
+	}
+	return nil
+}
+
+// 将参数中的列设置到data中，忽略file参数，其他列需在cols中声明
+func setPatchArgs(data *Data, args map[string]string, cols []Column) error {
+	data.Extra = maps.Clone(data.Extra)
+	for name, value := range args {
+		if name == "file" {
+			continue
+		}
+		col := columnOf(name)
+		if col.IsExtra() && !slices.Contains(cols, col) {
+			return fmt.Errorf("%s=%s: 码表中没有此列", name, value)
+		}
+		if err := data.Set(col, value); err != nil {
+			return fmt.Errorf("%s=%s: %w", name, value, err)
+		}
+	}
+	return nil
+}
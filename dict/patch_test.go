@@ -0,0 +1,125 @@
+package dict
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_ParsePatch(t *testing.T) {
+	content := "# 注释\n+ 你好\tnau\t10\n\n- 你好\tnau\n~ 你好\tnau weight=20\n> 你好\tnau file=user\n" +
+		"~ hello world\thw comment=\"很 常用\" weight=3\n+ 你好 nau comment=a=b\n"
+	ops, err := ParsePatch(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PatchOp{
+		{Line: 2, Type: PATCH_ADD, Entry: "你好\tnau\t10"},
+		{Line: 4, Type: PATCH_DELETE, Entry: "你好\tnau"},
+		{Line: 5, Type: PATCH_MODIFY, Entry: "你好\tnau", Args: map[string]string{"weight": "20"}},
+		{Line: 6, Type: PATCH_MOVE, Entry: "你好\tnau", Args: map[string]string{"file": "user"}},
+		{Line: 7, Type: PATCH_MODIFY, Entry: "hello world\thw", Args: map[string]string{"comment": "很 常用", "weight": "3"}},
+		{Line: 8, Type: PATCH_ADD, Entry: "你好 nau", Args: map[string]string{"comment": "a=b"}},
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("ParsePatch() = %v", ops)
+	}
+	for i := range want {
+		got := ops[i]
+		if got.Line != want[i].Line || got.Type != want[i].Type || got.Entry != want[i].Entry || len(got.Args) != len(want[i].Args) {
+			t.Errorf("ParsePatch()[%d] = %+v, want %+v", i, got, want[i])
+		}
+		for k, v := range want[i].Args {
+			if got.Args[k] != v {
+				t.Errorf("ParsePatch()[%d].Args[%s] = %q, want %q", i, k, got.Args[k], v)
+			}
+		}
+	}
+
+	for _, bad := range []string{"* 你好\tnau", "+ weight=1", "> 你好\tnau"} {
+		_, err := ParsePatch(strings.NewReader("# 注释\n" + bad))
+		var patchErr *PatchError
+		if !errors.As(err, &patchErr) || patchErr.Line != 2 {
+			t.Errorf("ParsePatch(%q) error = %v, want PatchError at line 2", bad, err)
+		}
+	}
+}
+
+func Test_Dictionary_ApplyPatch(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.dict.yaml")
+	user := filepath.Join(dir, "user.dict.yaml")
+	writeFiles(t, dir, map[string]string{
+		"main.dict.yaml": "---\nname: main\n...\n你好\tnau\t1\n再见\tzj\t1\n世界\tsj\t1\n",
+		"user.dict.yaml": "---\nname: user\n...\n",
+	})
+	open := func() *Dictionary {
+		dc, err := Open([]string{main, user}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dc
+	}
+	read := func(path string) string {
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(bs)
+	}
+	apply := func(dc *Dictionary, content string) error {
+		ops, err := ParsePatch(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = dc.ApplyPatch(ops, user)
+		return err
+	}
+
+	// 失败时不修改任何项
+	dc := open()
+	err := apply(dc, "- 你好\tnau\n~ 世界\tsj weight=5\n- 不存在\tbcz\n")
+	var patchErr *PatchError
+	if !errors.As(err, &patchErr) || patchErr.Line != 3 || !errors.Is(err, ErrPatchNotFound) {
+		t.Fatalf("ApplyPatch() error = %v, want ErrPatchNotFound at line 3", err)
+	}
+	if changes, err := dc.Save(context.Background()); err != nil || len(changes) != 0 {
+		t.Fatalf("Save() after failed patch = %v, %v", changes, err)
+	}
+	if err := apply(dc, "+ 你好\tnau file=main"); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("ApplyPatch() duplicate error = %v, want ErrDuplicate", err)
+	}
+	for _, bad := range []string{"+ 早\tz\tx", "+ 早\tz\t1\tzao", "+ 早\t \t1"} {
+		if err := apply(dc, bad); !errors.As(err, &patchErr) {
+			t.Errorf("ApplyPatch(%q) error = %v, want PatchError", bad, err)
+		}
+	}
+
+	dc = open()
+	if err := apply(dc, "+ 早上\tzs\t3\n- 再见\tzj\n~ 世界\tsj weight=5\n> 你好\tnau file=user\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(main); got != "---\nname: main\n...\n世界\tsj\t5\n" {
+		t.Errorf("main = %q", got)
+	}
+	if got := read(user); got != "---\nname: user\n...\n早上\tzs\t3\n你好\tnau\t1\n" {
+		t.Errorf("user = %q", got)
+	}
+
+	// 以制表符分隔时字词可以包含空格
+	if err := apply(dc, "+ hello world\thw\t2\n~ hello world\thw weight=4\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(user); !strings.HasSuffix(got, "\nhello world\thw\t4\n") {
+		t.Errorf("user = %q", got)
+	}
+}
@@ -0,0 +1,148 @@
+package dict
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/goccy/go-yaml"
+)
+
+// 方案中未声明时Rime使用的默认值
+const (
+	DEFAULT_ALPHABET  = "zyxwvutsrqponmlkjihgfedcba"
+	DEFAULT_DELIMITER = " '"
+)
+
+// CodeRule 是使用此码表的方案(schema)对编码的限制
+type CodeRule struct {
+	Schema        string // 方案文件的路径
+	Alphabet      string // speller/alphabet
+	Delimiter     string // speller/delimiter
+	MaxCodeLength int    // speller/max_code_length，0表示不限制
+}
+
+// Check 检查方案能否输入编码code，r为nil时不做检查
+func (r *CodeRule) Check(code string) error {
+	if r == nil {
+		return nil
+	}
+	isDelimiter := func(ru rune) bool {
+		return ru == ' ' || strings.ContainsRune(r.Delimiter, ru) // 码表中的空格用于分隔音节
+	}
+	for _, ru := range code {
+		if !strings.ContainsRune(r.Alphabet, ru) && !isDelimiter(ru) {
+			return fmt.Errorf("%w: [%s] 中的 '%c'，方案的字母表为 %s", ErrCodeAlphabet, code, ru, r.Alphabet)
+		}
+	}
+	if r.MaxCodeLength > 0 {
+		for seg := range strings.FieldsFuncSeq(code, isDelimiter) {
+			if utf8.RuneCountInString(seg) > r.MaxCodeLength {
+				return fmt.Errorf("%w: [%s] 超过 %d 码", ErrCodeTooLong, code, r.MaxCodeLength)
+			}
+		}
+	}
+	return nil
+}
+
+type schemaSpeller struct {
+	Alphabet      *string `yaml:"alphabet"`
+	Delimiter     *string `yaml:"delimiter"`
+	MaxCodeLength *int    `yaml:"max_code_length"`
+}
+
+type schemaYAML struct {
+	Speller    schemaSpeller `yaml:"speller"`
+	Translator struct {
+		Dictionary string `yaml:"dictionary"`
+	} `yaml:"translator"`
+}
+
+// 码表的名称，即yaml头部中的name，没有时使用文件名
+func dictName(path string, config *YAML) string {
+	if config != nil {
+		if name, ok := (*config)["name"].(string); ok && name != "" {
+			return name
+		}
+	}
+	name := filepath.Base(path)
+	for _, ext := range []string{".dict.yaml", ".txt", ".yaml"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// 在码表所在目录中查找以此码表为翻译器词典(translator/dictionary)的方案，
+// 读取其 speller 设置，并应用 方案名.custom.yaml 中的补丁。未找到方案时返回nil
+func findCodeRule(path, name string) (*CodeRule, error) {
+	dir := filepath.Dir(path)
+	schemas, err := filepath.Glob(filepath.Join(dir, "*.schema.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, schemaPath := range schemas {
+		bs, err := os.ReadFile(schemaPath)
+		if err != nil || !bytes.Contains(bs, []byte(name)) {
+			continue
+		}
+		var schema schemaYAML
+		if err := yaml.Unmarshal(bs, &schema); err != nil {
+			return nil, fileError("解析", schemaPath, err)
+		}
+		if schema.Translator.Dictionary != name {
+			continue
+		}
+		customPath := strings.TrimSuffix(schemaPath, ".schema.yaml") + ".custom.yaml"
+		if err := applySchemaPatch(customPath, &schema.Speller); err != nil {
+			return nil, fileError("解析", customPath, err)
+		}
+		rule := &CodeRule{Schema: schemaPath, Alphabet: DEFAULT_ALPHABET, Delimiter: DEFAULT_DELIMITER}
+		if schema.Speller.Alphabet != nil {
+			rule.Alphabet = *schema.Speller.Alphabet
+		}
+		if schema.Speller.Delimiter != nil {
+			rule.Delimiter = *schema.Speller.Delimiter
+		}
+		if schema.Speller.MaxCodeLength != nil {
+			rule.MaxCodeLength = *schema.Speller.MaxCodeLength
+		}
+		return rule, nil
+	}
+	return nil, nil
+}
+
+// 应用 方案名.custom.yaml 中 patch 下对 speller 的修改，文件不存在时忽略
+func applySchemaPatch(path string, speller *schemaSpeller) error {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var custom struct {
+		Patch map[string]any `yaml:"patch"`
+	}
+	if err := yaml.Unmarshal(bs, &custom); err != nil {
+		return err
+	}
+	if sp, ok := custom.Patch["speller"].(map[string]any); ok { // 整体替换speller
+		*speller = schemaSpeller{}
+		for k, v := range sp {
+			custom.Patch["speller/"+k] = v
+		}
+	}
+	if v, ok := custom.Patch["speller/alphabet"]; ok {
+		s := fmt.Sprint(v)
+		speller.Alphabet = &s
+	}
+	if v, ok := custom.Patch["speller/delimiter"]; ok {
+		s := fmt.Sprint(v)
+		speller.Delimiter = &s
+	}
+	if v, ok := custom.Patch["speller/max_code_length"]; ok {
+		n := yamlInt(v)
+		speller.MaxCodeLength = &n
+	}
+	return nil
+}
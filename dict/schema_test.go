@@ -0,0 +1,92 @@
+package dict
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_CodeRule_Check(t *testing.T) {
+	rule := &CodeRule{Alphabet: DEFAULT_ALPHABET, Delimiter: DEFAULT_DELIMITER, MaxCodeLength: 4}
+	tests := []struct {
+		code string
+		want error
+	}{
+		{"nau", nil},
+		{"ni hao", nil},
+		{"xi'an", nil},
+		{"nihao1", ErrCodeAlphabet},
+		{"Nau", ErrCodeAlphabet},
+		{"nihao", ErrCodeTooLong},
+	}
+	for _, tt := range tests {
+		if err := rule.Check(tt.code); !errors.Is(err, tt.want) {
+			t.Errorf("Check(%q) = %v, want %v", tt.code, err, tt.want)
+		}
+	}
+	var none *CodeRule
+	if err := none.Check("Nau1"); err != nil {
+		t.Errorf("nil CodeRule Check() = %v, want nil", err)
+	}
+}
+
+func Test_LoadItems_CodeRule(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"xkjd6.schema.yaml":        "schema:\n  schema_id: xkjd6\nspeller:\n  alphabet: abcdefghijklmnopqrstuvwxyz;\n  max_code_length: 6\ntranslator:\n  dictionary: xkjd6\n",
+		"xkjd6.custom.yaml":        "patch:\n  speller/max_code_length: 4\n",
+		"other.schema.yaml":        "translator:\n  dictionary: other\n",
+		"xkjd6.dict.yaml":          "---\nname: xkjd6\nimport_tables:\n  - xkjd6.extended\n...\n你好\tnau\t1\n",
+		"xkjd6.extended.dict.yaml": "---\nname: xkjd6.extended\n...\n再见\tzj;\t1\n",
+		"none.dict.yaml":           "---\nname: none\n...\n你好\tnau\t1\n",
+	})
+	fes := mustLoadItems(filepath.Join(dir, "xkjd6.dict.yaml"), filepath.Join(dir, "none.dict.yaml"))
+	for _, fe := range fes {
+		switch filepath.Base(fe.FilePath) {
+		case "xkjd6.dict.yaml", "xkjd6.extended.dict.yaml":
+			if fe.CodeRule == nil {
+				t.Fatalf("%s: CodeRule not found", fe.FilePath)
+			}
+			if fe.CodeRule.Alphabet != "abcdefghijklmnopqrstuvwxyz;" || fe.CodeRule.MaxCodeLength != 4 || fe.CodeRule.Delimiter != DEFAULT_DELIMITER {
+				t.Errorf("%s: CodeRule = %+v", fe.FilePath, fe.CodeRule)
+			}
+		case "none.dict.yaml":
+			if fe.CodeRule != nil {
+				t.Errorf("%s: CodeRule = %+v, want nil", fe.FilePath, fe.CodeRule)
+			}
+		}
+	}
+}
+
+func Test_Dictionary_Lint(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.schema.yaml": "speller:\n  max_code_length: 4\ntranslator:\n  dictionary: a\n",
+		"a.dict.yaml":   "---\nname: a\n...\n你好\tnau\t1\n# 注释\n你好\tnihao1\t1\n你好\tnau\t2\n",
+	})
+	path := filepath.Join(dir, "a.dict.yaml")
+	dc := NewDictionary(mustLoadItems(path), nil)
+	issues := dc.Lint()
+	want := []struct {
+		line int
+		err  error
+	}{{6, ErrCodeAlphabet}, {7, ErrDuplicate}}
+	if len(issues) != len(want) {
+		t.Fatalf("Lint() = %v, want %d issues", issues, len(want))
+	}
+	for i, w := range want {
+		if issues[i].Line != w.line || issues[i].FilePath != path || !errors.Is(issues[i].Err, w.err) {
+			t.Errorf("Lint()[%d] = %v, want line %d: %v", i, issues[i], w.line, w.err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package dict
+
+import (
+	"slices"
+)
+
+// Stats 是码表的统计数据，形码方案的维护者常用这些数据评估码表
+type Stats struct {
+	FilePath string `json:"file_path,omitempty"`
+	// 项数，不包括已删除的项
+	Entries int `json:"entries"`
+	// 不同编码的数量
+	Codes int `json:"codes"`
+	// 拥有多个候选的编码数量
+	DuplicateCodes int `json:"duplicate_codes"`
+	// 重码率 = 拥有多个候选的编码数量 / 不同编码的数量
+	DuplicateRate float64 `json:"duplicate_rate"`
+	// 单个编码下最多的候选数量，以及该编码
+	MaxCandidates     int    `json:"max_candidates"`
+	MaxCandidatesCode string `json:"max_candidates_code"`
+	// 编码长度分布，编码长度 -> 项数
+	CodeLengths map[int]int `json:"code_lengths"`
+	// 没有权重(权重为0或码表没有权重列)的项数
+	NoWeight int `json:"no_weight"`
+	// 单字与词组的项数
+	SingleChars int `json:"single_chars"`
+	Phrases     int `json:"phrases"`
+	// 扩展区汉字(CJK扩展A-J、兼容汉字等)的项数
+	ExtendedCJK int `json:"extended_cjk"`
+	// 每个文件的统计，仅在汇总的统计中存在
+	Files []Stats `json:"files,omitempty"`
+}
+
+func statsOf(entries []*Entry) Stats {
+	s := Stats{CodeLengths: make(map[int]int)}
+	candidates := make(map[string]int)
+	for _, entry := range entries {
+		if entry.IsDelete() {
+			continue
+		}
+		s.Entries++
+		data := &entry.data
+		candidates[data.Code]++
+		s.CodeLengths[len(data.Code)]++
+		if data.Weight == 0 || !hasWeight(entry) {
+			s.NoWeight++
+		}
+		if len([]rune(data.Text)) == 1 {
+			s.SingleChars++
+			if isExtendedCJK(data.Text) {
+				s.ExtendedCJK++
+			}
+		} else {
+			s.Phrases++
+		}
+	}
+	codes := make([]string, 0, len(candidates))
+	for code := range candidates {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes) // 候选数量相同时取编码较小的，使结果稳定
+	for _, code := range codes {
+		count := candidates[code]
+		if count > 1 {
+			s.DuplicateCodes++
+		}
+		if count > s.MaxCandidates {
+			s.MaxCandidates = count
+			s.MaxCandidatesCode = code
+		}
+	}
+	s.Codes = len(candidates)
+	if s.Codes > 0 {
+		s.DuplicateRate = float64(s.DuplicateCodes) / float64(s.Codes)
+	}
+	return s
+}
+
+// Stats 统计所有已加载的词典，以及每个文件
+func (d *Dictionary) Stats() Stats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	s := statsOf(d.entries)
+	for _, fe := range d.fileEntries {
+		fs := statsOf(fe.Entries)
+		fs.FilePath = fe.FilePath
+		s.Files = append(s.Files, fs)
+	}
+	return s
+}
@@ -0,0 +1,45 @@
+package dict
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Dictionary_Stats(t *testing.T) {
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	cols2 := []Column{COLUMN_TEXT, COLUMN_CODE}
+	fe1 := &FileEntries{ID: 1, FilePath: "a.dict.yaml", Entries: []*Entry{
+		NewEntry([]byte("那	na	10"), 1, 0, 0, &cols),
+		NewEntry([]byte("拿	na	20"), 1, 10, 0, &cols),
+		NewEntry([]byte("哪	na"), 1, 20, 0, &cols),
+		NewEntry([]byte("你好	nau	30"), 1, 30, 0, &cols),
+		NewEntry([]byte("㐀	ab	1"), 1, 40, 0, &cols),
+	}}
+	fe2 := &FileEntries{ID: 2, FilePath: "b.dict.yaml", Entries: []*Entry{
+		NewEntry([]byte("你好	nau"), 2, 0, 0, &cols2),
+		NewEntry([]byte("删除	sc"), 2, 10, 0, &cols2),
+	}}
+	fe2.Entries[1].Delete()
+	got := NewDictionary([]*FileEntries{fe1, fe2}, nil).Stats()
+	want := Stats{
+		Entries:           6,
+		Codes:             3,
+		DuplicateCodes:    2,
+		DuplicateRate:     2.0 / 3.0,
+		MaxCandidates:     3,
+		MaxCandidatesCode: "na",
+		CodeLengths:       map[int]int{2: 4, 3: 2},
+		NoWeight:          2,
+		SingleChars:       4,
+		Phrases:           2,
+		ExtendedCJK:       1,
+	}
+	files := got.Files
+	got.Files = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if len(files) != 2 || files[0].FilePath != "a.dict.yaml" || files[0].Entries != 5 || files[1].Entries != 1 || files[1].NoWeight != 1 {
+		t.Errorf("Stats() files = %+v", files)
+	}
+}
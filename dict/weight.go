@@ -0,0 +1,517 @@
+package dict
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Batch 是一次批量修改，记录了修改前的内容，可通过 Dictionary.Undo 撤销
+type Batch struct {
+	Name    string
+	changes []batchChange
+	added   []*Entry
+	columns map[*FileEntries][]Column
+	after   map[*Entry]entryAfter // 批量修改完成后各项的内容，撤销前据此检查是否又被修改
+}
+
+type entryAfter struct {
+	raw     string
+	deleted bool
+}
+
+type batchChange struct {
+	entry   *Entry
+	raw     string
+	modType ModifyType // 修改前的变更类型
+	saves   int        // 修改前的写入次数
+	deleted bool
+}
+
+// Len 返回此次批量修改所修改(包括新增、删除)的项数
+func (b *Batch) Len() int {
+	return len(b.changes) + len(b.added)
+}
+
+// 删除 entry，撤销时恢复
+func (b *Batch) delete(entry *Entry) {
+	if entry.IsDelete() {
+		return
+	}
+	b.changes = append(b.changes, batchChange{entry: entry, deleted: true, modType: entry.modType, saves: entry.saves})
+	entry.Delete()
+}
+
+// 以 entry 当前的内容作为撤销的依据，然后修改为 raw，若内容没有变化则忽略
+func (b *Batch) reRaw(entry *Entry, raw string) {
+	if entry.raw == raw {
+		return
+	}
+	b.changes = append(b.changes, batchChange{entry: entry, raw: entry.raw, modType: entry.modType, saves: entry.saves})
+	entry.ReRaw(raw)
+}
+
+// 是否修改了fe中的项或fe的列
+func (b *Batch) touches(fe *FileEntries) bool {
+	if _, ok := b.columns[fe]; ok {
+		return true
+	}
+	return slices.ContainsFunc(b.added, func(e *Entry) bool { return e.FID == fe.ID }) ||
+		slices.ContainsFunc(b.changes, func(c batchChange) bool { return c.entry.FID == fe.ID })
+}
+
+// 在修改 fe 的列之前调用，以便撤销时恢复
+func (b *Batch) keepColumns(fe *FileEntries) {
+	if b.columns == nil {
+		b.columns = make(map[*FileEntries][]Column)
+	}
+	if _, ok := b.columns[fe]; !ok {
+		b.columns[fe] = slices.Clone(fe.Columns)
+	}
+}
+
+func (d *Dictionary) commit(b *Batch) *Batch {
+	if len(b.changes) == 0 && len(b.added) == 0 && len(b.columns) == 0 {
+		return nil
+	}
+	b.after = make(map[*Entry]entryAfter)
+	for _, entry := range b.added {
+		b.after[entry] = entryAfter{entry.raw, entry.deleted}
+	}
+	for _, c := range b.changes {
+		b.after[c.entry] = entryAfter{c.entry.raw, c.entry.deleted}
+	}
+	d.history = append(d.history, b)
+	return b
+}
+
+// 批量修改完成后又被修改(或恢复了删除)的项数，撤销这些项会丢失之后的修改
+func (b *Batch) edited() int {
+	count := 0
+	for entry, after := range b.after {
+		if (!after.deleted && entry.raw != after.raw) || (after.deleted && !entry.deleted) {
+			count++
+		}
+	}
+	return count
+}
+
+// Undo 撤销最近的一次批量修改，没有可撤销的修改时返回nil。
+// 其中的项在批量修改后又被修改时不撤销，返回此次批量修改与 ErrEditedAfterBatch，可将这些项改回后再撤销
+func (d *Dictionary) Undo() (*Batch, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.history) == 0 {
+		return nil, nil
+	}
+	b := d.history[len(d.history)-1]
+	if n := b.edited(); n > 0 {
+		return b, fmt.Errorf("%w: %d 项", ErrEditedAfterBatch, n)
+	}
+	d.history = d.history[:len(d.history)-1]
+	b.undo()
+	return b, nil
+}
+
+// 撤销修改。修改已写入文件时，恢复的内容需重新写入：修改的项标记为修改，删除的项重新添加到文件中
+func (b *Batch) undo() {
+	for _, entry := range b.added {
+		if entry.modType == ADD { // 尚未写入文件
+			entry.deleted, entry.modType = true, NC
+			continue
+		}
+		entry.Delete()
+	}
+	for fe, cols := range b.columns {
+		fe.Columns = cols
+	}
+	for i := len(b.changes) - 1; i >= 0; i-- {
+		c := b.changes[i]
+		saved := c.entry.saves != c.saves
+		if c.deleted {
+			c.entry.deleted = false
+			if saved {
+				c.entry.modType = ADD
+			}
+		} else {
+			c.entry.ReRaw(c.raw)
+		}
+		if !saved {
+			c.entry.modType = c.modType
+		}
+	}
+}
+
+func (d *Dictionary) fileOf(entry *Entry) *FileEntries {
+	for _, fe := range d.fileEntries {
+		if fe.ID == entry.FID {
+			return fe
+		}
+	}
+	return nil
+}
+
+func hasWeight(entry *Entry) bool {
+	return entry.data.cols != nil && slices.Contains(*entry.data.cols, COLUMN_WEIGHT)
+}
+
+// 按编码分组，组内按照Rime的候选顺序排列，忽略已删除的项
+func (d *Dictionary) groupByCode(entries []*Entry) [][]*Entry {
+	fileOrder := d.fileOrder()
+	groups := make(map[string][]*Entry)
+	codes := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDelete() {
+			continue
+		}
+		code := entry.data.Code
+		if _, ok := groups[code]; !ok {
+			codes = append(codes, code)
+		}
+		groups[code] = append(groups[code], entry)
+	}
+	ret := make([][]*Entry, 0, len(codes))
+	for _, code := range codes {
+		group := groups[code]
+		sort.SliceStable(group, func(i, j int) bool {
+			return candidateLess(group[i], group[j], fileOrder)
+		})
+		ret = append(ret, group)
+	}
+	return ret
+}
+
+// RenumberWeights 将每个编码下的项的权重重排为连续的序号，首选为n，末选为1
+func (d *Dictionary) RenumberWeights(entries []*Entry) *Batch {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b := &Batch{Name: "重排权重"}
+	for _, group := range d.groupByCode(d.writable(entries)) {
+		group = slices.DeleteFunc(group, func(e *Entry) bool { return !hasWeight(e) })
+		for i, entry := range group {
+			data := entry.data
+			data.Weight = len(group) - i
+			b.reRaw(entry, data.ToString())
+		}
+	}
+	return d.commit(b)
+}
+
+// ClampWeights 将权重限制在[floor, ceiling]之间，ceiling <= 0 时不限制上限
+func (d *Dictionary) ClampWeights(entries []*Entry, floor, ceiling int) *Batch {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b := &Batch{Name: "限制权重"}
+	for _, entry := range d.writable(entries) {
+		if entry.IsDelete() || !hasWeight(entry) {
+			continue
+		}
+		data := entry.data
+		data.Weight = max(data.Weight, floor)
+		if ceiling > 0 {
+			data.Weight = min(data.Weight, ceiling)
+		}
+		b.reRaw(entry, data.ToString())
+	}
+	return d.commit(b)
+}
+
+type FrequencyMapping string
+
+// 词频到权重的映射方式
+const (
+	FREQ_LINEAR FrequencyMapping = "linear" // 线性缩放到[floor, ceiling]
+	FREQ_LOG    FrequencyMapping = "log"    // 取对数后缩放到[floor, ceiling]
+	FREQ_RANK   FrequencyMapping = "rank"   // 按词频排名，词频最高的权重为词频表中不同词频的数量，最低的为1
+	FREQ_RAW    FrequencyMapping = "raw"    // 直接使用词频作为权重
+)
+
+// Unmatched 是词频表中没有匹配到任何项的字词
+type Unmatched struct {
+	Text   string
+	Count  int
+	Weight int // 按映射方式得到的权重
+}
+
+// 根据词频表生成 词频 -> 权重 的映射，结果不小于floor，ceiling > 0 时不大于ceiling
+func frequencyMapper(freq map[string]int, mapping FrequencyMapping, floor, ceiling int) (func(count int) int, error) {
+	maxCount := 0
+	for _, count := range freq {
+		maxCount = max(maxCount, count)
+	}
+	clamp := func(w int) int {
+		w = max(w, floor)
+		if ceiling > 0 {
+			w = min(w, ceiling)
+		}
+		return w
+	}
+	switch mapping {
+	case FREQ_LINEAR, FREQ_LOG:
+		if ceiling <= floor {
+			return nil, fmt.Errorf("映射方式 %s 需要权重上限大于下限", mapping)
+		}
+		scale := func(c int) float64 { return float64(c) / float64(max(maxCount, 1)) }
+		if mapping == FREQ_LOG {
+			scale = func(c int) float64 { return math.Log1p(float64(c)) / math.Log1p(float64(max(maxCount, 1))) }
+		}
+		return func(count int) int {
+			return clamp(floor + int(math.Round(scale(count)*float64(ceiling-floor))))
+		}, nil
+	case FREQ_RANK:
+		counts := make([]int, 0, len(freq))
+		for _, count := range freq {
+			counts = append(counts, count)
+		}
+		slices.Sort(counts)
+		counts = slices.Compact(counts)
+		return func(count int) int {
+			rank, _ := slices.BinarySearch(counts, count)
+			return clamp(rank + 1)
+		}, nil
+	case FREQ_RAW:
+		return clamp, nil
+	default:
+		return nil, fmt.Errorf("未知的词频映射方式: %s，可选值为 linear|log|rank|raw", mapping)
+	}
+}
+
+// ScaleWeights 根据词频表(字词 -> 频数)，将词频线性缩放到[floor, ceiling]之间作为权重，词频表中不存在的项保持不变
+func (d *Dictionary) ScaleWeights(entries []*Entry, freq map[string]int, floor, ceiling int) *Batch {
+	mapper, err := frequencyMapper(freq, FREQ_LINEAR, floor, ceiling)
+	if err != nil || len(freq) == 0 {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b := &Batch{Name: "按词频缩放权重"}
+	d.mapFrequency(b, entries, freq, mapper)
+	return d.commit(b)
+}
+
+// 将entries中出现在词频表里的项的权重设为mapper映射后的词频
+func (d *Dictionary) mapFrequency(b *Batch, entries []*Entry, freq map[string]int, mapper func(count int) int) {
+	for _, entry := range d.writable(entries) {
+		if entry.IsDelete() || !hasWeight(entry) {
+			continue
+		}
+		count, ok := freq[entry.data.Text]
+		if !ok {
+			continue
+		}
+		data := entry.data
+		data.Weight = mapper(count)
+		b.reRaw(entry, data.ToString())
+	}
+}
+
+// ImportFrequency 根据词频表(字词 -> 词频)，按字词匹配entries并将词频映射为权重，
+// 同时返回词频表中没有匹配到任何已加载项的字词，按词频从高到低排列
+func (d *Dictionary) ImportFrequency(entries []*Entry, freq map[string]int, mapping FrequencyMapping, floor, ceiling int) (*Batch, []Unmatched, error) {
+	mapper, err := frequencyMapper(freq, mapping, floor, ceiling)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b := &Batch{Name: "导入词频"}
+	d.mapFrequency(b, entries, freq, mapper)
+	loaded := make(map[string]bool)
+	for _, entry := range d.entries {
+		if !entry.IsDelete() {
+			loaded[entry.data.Text] = true
+		}
+	}
+	unmatched := make([]Unmatched, 0)
+	for text, count := range freq {
+		if !loaded[text] {
+			unmatched = append(unmatched, Unmatched{Text: text, Count: count, Weight: mapper(count)})
+		}
+	}
+	sort.Slice(unmatched, func(i, j int) bool {
+		if unmatched[i].Count == unmatched[j].Count {
+			return unmatched[i].Text < unmatched[j].Text
+		}
+		return unmatched[i].Count > unmatched[j].Count
+	})
+	return d.commit(b), unmatched, nil
+}
+
+// AddWords 按造词规则为字词生成编码并添加到fe中，返回无法生成编码的字词
+func (d *Dictionary) AddWords(fe *FileEntries, words []Unmatched) (*Batch, []Unmatched, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if fe.Readonly {
+		return nil, words, ErrReadonly
+	}
+	encode, err := d.wordEncoder(fe)
+	if err != nil {
+		return nil, words, err
+	}
+	b := &Batch{Name: "添加未匹配的字词"}
+	failed := make([]Unmatched, 0)
+	for _, word := range words {
+		code, err := encode(word.Text)
+		if err != nil {
+			failed = append(failed, word)
+			continue
+		}
+		data := Data{Text: word.Text, Code: code, Weight: word.Weight, cols: &fe.Columns}
+		entry := NewEntryAdd(data.ToString(), fe.ID, data)
+		d.add(entry)
+		b.added = append(b.added, entry)
+	}
+	return d.commit(b), failed, nil
+}
+
+var (
+	ErrColumnsDeclared = errors.New("码表头部声明了columns，请先手动修改码表的columns")
+	ErrHasWeight       = errors.New("码表已包含权重列")
+	ErrNoWeight        = errors.New("码表不包含权重列")
+	// 撤销会丢失批量修改之后的修改
+	ErrEditedAfterBatch = errors.New("批量调整后又修改了其中的项，为避免丢失这些修改而未撤销")
+)
+
+// ToWeighted 将依靠行序决定候选顺序的码表转换为带权重的码表，每个编码下的项按行序生成权重
+func (d *Dictionary) ToWeighted(fe *FileEntries) (*Batch, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if fe.Readonly {
+		return nil, ErrReadonly
+	}
+	if slices.Contains(fe.Columns, COLUMN_WEIGHT) {
+		return nil, ErrHasWeight
+	}
+	if fe.columnsDeclared {
+		return nil, ErrColumnsDeclared
+	}
+	b := &Batch{Name: "转换为带权重的码表"}
+	b.keepColumns(fe)
+	fe.Columns = append(slices.Clone(fe.Columns), COLUMN_WEIGHT)
+	for _, group := range d.groupByCode(fe.Entries) {
+		for i, entry := range group {
+			data := entry.data
+			data.Weight = len(group) - i
+			b.reRaw(entry, data.ToString())
+		}
+	}
+	return d.commit(b), nil
+}
+
+// ToOrderOnly 将带权重的码表转换为依靠行序决定候选顺序的码表，
+// 每个编码下的项按权重重新排列在原有的行中，然后移除权重列
+func (d *Dictionary) ToOrderOnly(fe *FileEntries) (*Batch, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if fe.Readonly {
+		return nil, ErrReadonly
+	}
+	if !slices.Contains(fe.Columns, COLUMN_WEIGHT) {
+		return nil, ErrNoWeight
+	}
+	if fe.columnsDeclared {
+		return nil, ErrColumnsDeclared
+	}
+	b := &Batch{Name: "转换为按行序排列的码表"}
+	cols := slices.DeleteFunc(slices.Clone(fe.Columns), func(c Column) bool { return c == COLUMN_WEIGHT })
+	raws := make(map[*Entry]string)
+	for _, group := range d.groupByCode(fe.Entries) {
+		// group已按权重排列，将其依次放入原有的行中
+		slots := slices.Clone(group)
+		sort.SliceStable(slots, func(i, j int) bool {
+			return physicalLess(slots[i], slots[j])
+		})
+		for i, slot := range slots {
+			raws[slot] = group[i].data.withRest(group[i].data.ToStringWithColumns(&cols))
+		}
+	}
+	b.keepColumns(fe)
+	fe.Columns = cols
+	for _, entry := range fe.Entries {
+		if raw, ok := raws[entry]; ok {
+			b.reRaw(entry, raw)
+		}
+	}
+	return d.commit(b), nil
+}
+
+// MoveLine 在不带权重、依靠行序决定候选顺序的码表中，将entry所在的行移动到同一文件中编码相同的前一项之前(earlier为false时为后一项之后)，
+// 使其在候选中前移或后移一位，移动在写入文件时生效。尚未写入文件的新增项没有所在的行，此时与相邻项交换内容。
+// 返回移动后持有entry原内容的项，没有可移动到的位置时返回nil
+func (d *Dictionary) MoveLine(entry *Entry, earlier bool) (*Entry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.checkWritable(entry); err != nil {
+		return nil, err
+	}
+	if hasWeight(entry) {
+		return nil, ErrHasWeight
+	}
+	fe := d.fileOf(entry)
+	group := slices.DeleteFunc(slices.Clone(fe.Entries), func(e *Entry) bool {
+		return e.IsDelete() || e.data.Code != entry.data.Code
+	})
+	sort.SliceStable(group, func(i, j int) bool {
+		return physicalLess(group[i], group[j])
+	})
+	i := slices.Index(group, entry)
+	j := i + 1
+	if earlier {
+		j = i - 1
+	}
+	if i == -1 || j < 0 || j >= len(group) {
+		return nil, nil
+	}
+	other := group[j]
+	if entry.modType == ADD || other.modType == ADD {
+		raw := entry.raw
+		entry.ReRaw(other.raw)
+		other.ReRaw(raw)
+		return other, nil
+	}
+	at := other.seek
+	if !earlier {
+		at = other.seek + other.rawSize
+	}
+	fe.moveLine(entry, at)
+	return entry, nil
+}
+
+// LoadFrequency 读取词频表，每行为 字词<TAB>频数，忽略空行与#开头的注释
+func LoadFrequency(path string) (map[string]int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	freq := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			fields = strings.Fields(line)
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(fields[len(fields)-1]))
+		if err != nil {
+			continue
+		}
+		text := strings.TrimSpace(fields[0])
+		freq[text] += count
+	}
+	return freq, scanner.Err()
+}
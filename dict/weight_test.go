@@ -0,0 +1,357 @@
+package dict
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_RenumberWeights(t *testing.T) {
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	fe := &FileEntries{ID: 1, Columns: cols, Entries: []*Entry{
+		NewEntry([]byte("那	na	100"), 1, 0, 0, &cols),
+		NewEntry([]byte("拿	na	300"), 1, 10, 0, &cols),
+		NewEntry([]byte("哪	na	100"), 1, 20, 0, &cols),
+		NewEntry([]byte("你	ni	30"), 1, 30, 0, &cols),
+	}}
+	dc := NewDictionary([]*FileEntries{fe}, nil)
+	batch := dc.RenumberWeights(fe.Entries)
+	if batch == nil || batch.Len() != 4 {
+		t.Fatalf("RenumberWeights() batch = %+v, want 4 changes", batch)
+	}
+	got := make([]string, 0)
+	for _, e := range fe.Entries {
+		got = append(got, e.Raw())
+	}
+	want := []string{"那	na	2", "拿	na	3", "哪	na	1", "你	ni	1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RenumberWeights() = %v, want %v", got, want)
+	}
+	if dc.RenumberWeights(fe.Entries) != nil {
+		t.Errorf("RenumberWeights() again should change nothing")
+	}
+	dc.Undo()
+	got = got[:0]
+	for _, e := range fe.Entries {
+		got = append(got, e.Raw())
+	}
+	want = []string{"那	na	100", "拿	na	300", "哪	na	100", "你	ni	30"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Undo() = %v, want %v", got, want)
+	}
+}
+
+func Test_ToOrderOnly(t *testing.T) {
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	fe := &FileEntries{ID: 1, Columns: cols}
+	fe.Entries = []*Entry{
+		NewEntry([]byte("那	na	1"), 1, 0, 0, &fe.Columns),
+		NewEntry([]byte("你	ni	30"), 1, 10, 0, &fe.Columns),
+		NewEntry([]byte("拿	na	3"), 1, 20, 0, &fe.Columns),
+		NewEntry([]byte("哪	na	2"), 1, 30, 0, &fe.Columns),
+	}
+	dc := NewDictionary([]*FileEntries{fe}, nil)
+	if _, err := dc.ToWeighted(fe); err != ErrHasWeight {
+		t.Errorf("ToWeighted() err = %v, want %v", err, ErrHasWeight)
+	}
+	if _, err := dc.ToOrderOnly(fe); err != nil {
+		t.Fatalf("ToOrderOnly() err = %v", err)
+	}
+	got := make([]string, 0)
+	for _, e := range fe.Entries {
+		got = append(got, e.Raw())
+	}
+	want := []string{"拿	na", "你	ni", "哪	na", "那	na"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToOrderOnly() = %v, want %v", got, want)
+	}
+	if _, err := dc.ToWeighted(fe); err != nil {
+		t.Fatalf("ToWeighted() err = %v", err)
+	}
+	got = got[:0]
+	for _, e := range fe.Entries {
+		got = append(got, e.Raw())
+	}
+	want = []string{"拿	na	3", "你	ni	1", "哪	na	2", "那	na	1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToWeighted() = %v, want %v", got, want)
+	}
+	dc.Undo()
+	dc.Undo()
+	got = got[:0]
+	for _, e := range fe.Entries {
+		got = append(got, e.Raw())
+	}
+	want = []string{"那	na	1", "你	ni	30", "拿	na	3", "哪	na	2"}
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(fe.Columns, cols) {
+		t.Errorf("Undo() = %v %v, want %v %v", got, fe.Columns, want, cols)
+	}
+}
+
+func Test_ScaleWeights(t *testing.T) {
+	freq := map[string]int{"你好": 1000, "那": 500, "哪": 250}
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	fe := &FileEntries{ID: 1, Columns: cols, Entries: []*Entry{
+		NewEntry([]byte("你好	nau	1"), 1, 0, 0, &cols),
+		NewEntry([]byte("那	na	1"), 1, 10, 0, &cols),
+		NewEntry([]byte("哪	na	1"), 1, 20, 0, &cols),
+		NewEntry([]byte("拿	na	7"), 1, 30, 0, &cols),
+	}}
+	dc := NewDictionary([]*FileEntries{fe}, nil)
+	if b := dc.ScaleWeights(fe.Entries, freq, 100, 0); b != nil {
+		t.Errorf("ScaleWeights() with ceiling <= floor = %v, want nil", b)
+	}
+	dc.ScaleWeights(fe.Entries, freq, 0, 100)
+	got := make([]int, 0)
+	for _, e := range fe.Entries {
+		got = append(got, e.Data().Weight)
+	}
+	if !reflect.DeepEqual(got, []int{100, 50, 25, 7}) {
+		t.Errorf("ScaleWeights() = %v", got)
+	}
+}
+
+func Test_ImportFrequency(t *testing.T) {
+	_ = os.MkdirAll("./tmp", os.ModePerm)
+	defer func() { _ = os.RemoveAll("./tmp") }()
+	path := createFile("./tmp/freq.txt", "# 词频\n你好\t1000\n那\t500\n\n哪 250\n测试\t100\n")
+	freq, err := LoadFrequency(path)
+	if err != nil {
+		t.Fatalf("LoadFrequency() err = %v", err)
+	}
+	if !reflect.DeepEqual(freq, map[string]int{"你好": 1000, "那": 500, "哪": 250, "测试": 100}) {
+		t.Errorf("LoadFrequency() = %v", freq)
+	}
+	tests := []struct {
+		name    string
+		mapping FrequencyMapping
+		floor   int
+		ceiling int
+		want    []int
+	}{
+		{name: "linear", mapping: FREQ_LINEAR, floor: 0, ceiling: 100, want: []int{100, 50, 25, 7}},
+		{name: "log", mapping: FREQ_LOG, floor: 0, ceiling: 100, want: []int{100, 90, 80, 7}},
+		{name: "rank", mapping: FREQ_RANK, floor: 1, ceiling: 0, want: []int{4, 3, 2, 7}},
+		{name: "raw", mapping: FREQ_RAW, floor: 1, ceiling: 600, want: []int{600, 500, 250, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+			fe := &FileEntries{ID: 1, Columns: cols, Entries: []*Entry{
+				NewEntry([]byte("你好	nau	1"), 1, 0, 0, &cols),
+				NewEntry([]byte("那	na	1"), 1, 10, 0, &cols),
+				NewEntry([]byte("哪	na	1"), 1, 20, 0, &cols),
+				NewEntry([]byte("拿	na	7"), 1, 30, 0, &cols),
+			}}
+			dc := NewDictionary([]*FileEntries{fe}, nil)
+			_, unmatched, err := dc.ImportFrequency(fe.Entries, freq, tt.mapping, tt.floor, tt.ceiling)
+			if err != nil {
+				t.Fatalf("ImportFrequency() err = %v", err)
+			}
+			got := make([]int, 0)
+			for _, e := range fe.Entries {
+				got = append(got, e.Data().Weight)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ImportFrequency() = %v, want %v", got, tt.want)
+			}
+			if len(unmatched) != 1 || unmatched[0].Text != "测试" {
+				t.Errorf("ImportFrequency() unmatched = %+v", unmatched)
+			}
+		})
+	}
+}
+
+func Test_MoveLine(t *testing.T) {
+	dir := t.TempDir()
+	// 最后一行没有换行符
+	writeFiles(t, dir, map[string]string{"a.dict.yaml": "---\nname: a\n...\n阿\ta\n你\tni\n# 注释\n啊\ta\n吖\ta"})
+	path := filepath.Join(dir, "a.dict.yaml")
+	dc, err := Open([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	find := func(text string) *Entry { return dc.Find(text, "")[0] }
+	candidates := func() string {
+		texts := make([]string, 0)
+		for _, c := range dc.Candidates("a") {
+			texts = append(texts, c.Entry.Data().Text)
+		}
+		return strings.Join(texts, " ")
+	}
+	save := func(want string) []string {
+		t.Helper()
+		changes, err := dc.Save(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bs, _ := os.ReadFile(path); string(bs) != want {
+			t.Errorf("Save() = %q, want %q", bs, want)
+		}
+		lines := make([]string, len(changes))
+		for i, c := range changes {
+			lines[i] = string(c.Type) + " " + c.Raw
+		}
+		return lines
+	}
+
+	entry := find("吖")
+	if moved, err := dc.MoveLine(entry, true); err != nil || moved != entry {
+		t.Fatalf("MoveLine() = %v, %v", moved, err)
+	}
+	// 写入前即可移动多次
+	if moved, _ := dc.MoveLine(entry, true); moved != entry {
+		t.Fatalf("MoveLine() again = %v", moved)
+	}
+	if moved, _ := dc.MoveLine(entry, true); moved != nil {
+		t.Errorf("MoveLine() first candidate earlier = %v, want nil", moved)
+	}
+	if got := candidates(); got != "吖 阿 啊" {
+		t.Errorf("Candidates() = %q", got)
+	}
+	if pending := dc.Pending(); len(pending) != 1 || pending[0].Type != CHANGE_MOVE {
+		t.Errorf("Pending() = %v", pending)
+	}
+	// 移动记录为MOVE，而不是内容相同的修改
+	if changes := save("---\nname: a\n...\n吖\ta\n阿\ta\n你\tni\n# 注释\n啊\ta\n"); !slices.Equal(changes, []string{"MOVE 吖\ta"}) {
+		t.Errorf("Save() changes = %q", changes)
+	}
+
+	// 移动到最后一行之后，并与修改一同写入
+	if err := dc.Update(find("啊"), func(data *Data) { data.Text = "呵" }); err != nil {
+		t.Fatal(err)
+	}
+	if moved, _ := dc.MoveLine(find("阿"), false); moved == nil {
+		t.Fatal("MoveLine() later = nil")
+	}
+	if got := candidates(); got != "吖 呵 阿" {
+		t.Errorf("Candidates() = %q", got)
+	}
+	if changes := save("---\nname: a\n...\n吖\ta\n你\tni\n# 注释\n呵\ta\n阿\ta\n"); !slices.Equal(changes, []string{"MOD 呵\ta", "MOVE 阿\ta"}) {
+		t.Errorf("Save() changes = %q", changes)
+	}
+	if items := dc.Changelog(); len(items) != 1 || items[0].After != "呵\ta" {
+		t.Errorf("Changelog() = %v, moves should not be recorded", items)
+	}
+
+	// 改回原内容时没有变更
+	for _, raw := range []string{"你\tnii", "你\tni"} {
+		if err := dc.ReRaw(find("你"), raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pending := dc.Pending(); len(pending) != 0 {
+		t.Errorf("Pending() after reverting the edit = %v", pending)
+	}
+	if changes := save("---\nname: a\n...\n吖\ta\n你\tni\n# 注释\n呵\ta\n阿\ta\n"); len(changes) != 0 {
+		t.Errorf("Save() after reverting the edit = %q", changes)
+	}
+
+	// 尚未写入的新增项与相邻项交换内容
+	added, err := dc.Insert(dc.fileEntries[0], Data{Text: "嗄", Code: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved, _ := dc.MoveLine(added, true); moved != find("嗄") || moved == added {
+		t.Errorf("MoveLine() added = %v", moved)
+	}
+	save("---\nname: a\n...\n吖\ta\n你\tni\n# 注释\n呵\ta\n嗄\ta\n阿\ta\n")
+
+	weighted := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	entry = NewEntry([]byte("那	na	1"), 2, 0, 0, &weighted)
+	dc = NewDictionary([]*FileEntries{{ID: 2, Columns: weighted, Entries: []*Entry{entry}}}, nil)
+	if _, err := dc.MoveLine(entry, true); err != ErrHasWeight {
+		t.Errorf("MoveLine() weighted err = %v, want %v", err, ErrHasWeight)
+	}
+}
+
+// 写入文件后撤销，撤销的内容需要再次写入
+func Test_Undo_afterFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.dict.yaml")
+	raw := "---\nname: a\n...\n那\tna\t100\n你\tni\t30\n"
+	if err := os.WriteFile(path, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := Open([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe := dc.fileEntries[0]
+	if dc.ClampWeights(fe.Entries, 0, 50) == nil {
+		t.Fatal("ClampWeights() changed nothing")
+	}
+	ops, err := ParsePatch(strings.NewReader("- 你\tni\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.ApplyPatch(ops, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := os.ReadFile(path); string(bs) != "---\nname: a\n...\n那\tna\t50\n" {
+		t.Fatalf("file after flush = %q", bs)
+	}
+	dc.Undo()
+	dc.Undo()
+	changes, err := dc.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Errorf("Flush() after Undo() changes = %+v, want 2", changes)
+	}
+	if bs, _ := os.ReadFile(path); string(bs) != raw {
+		t.Errorf("file after undo = %q, want %q", bs, raw)
+	}
+	// 撤销尚未写入的新增项，不产生变更
+	ops, _ = ParsePatch(strings.NewReader("+ 好\thao\t1\n"))
+	if _, err := dc.ApplyPatch(ops, ""); err != nil {
+		t.Fatal(err)
+	}
+	dc.Undo()
+	if changes, _ := dc.Flush(); len(changes) != 0 {
+		t.Errorf("Flush() after undoing an unsaved add = %+v", changes)
+	}
+	if bs, _ := os.ReadFile(path); string(bs) != raw {
+		t.Errorf("file after undoing an unsaved add = %q", bs)
+	}
+}
+
+// 批量调整后又修改了其中的项时不撤销，以免丢失之后的修改
+func Test_Undo_editedAfterBatch(t *testing.T) {
+	cols := []Column{COLUMN_TEXT, COLUMN_CODE, COLUMN_WEIGHT}
+	fe := &FileEntries{ID: 1, Columns: cols, Entries: []*Entry{
+		NewEntry([]byte("那	na	100"), 1, 0, 0, &cols),
+		NewEntry([]byte("你	ni	30"), 1, 10, 0, &cols),
+	}}
+	dc := NewDictionary([]*FileEntries{fe}, nil)
+	if dc.ClampWeights(fe.Entries, 0, 50) == nil {
+		t.Fatal("ClampWeights() changed nothing")
+	}
+	if err := dc.ReRaw(fe.Entries[0], "那	na	60"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := dc.Undo(); b == nil || !errors.Is(err, ErrEditedAfterBatch) {
+		t.Fatalf("Undo() = %v, %v, want ErrEditedAfterBatch", b, err)
+	}
+	if fe.Entries[0].Raw() != "那	na	60" {
+		t.Errorf("Undo() overwrote the later edit: %q", fe.Entries[0].Raw())
+	}
+	// 改回批量调整后的内容后可以撤销
+	if err := dc.ReRaw(fe.Entries[0], "那	na	50"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if fe.Entries[0].Raw() != "那	na	100" {
+		t.Errorf("Undo() = %q", fe.Entries[0].Raw())
+	}
+}
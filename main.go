@@ -1,20 +1,28 @@
 package main
 
 import (
-	"log"
-	"path/filepath"
+	"fmt"
+	"os"
 
 	"github.com/MapoMagpie/rimedm/core"
-	"github.com/charmbracelet/bubbletea"
 	// "net/http"
 	// _ "net/http/pprof"
 )
 
 func main() {
-	opts, configPath := core.ParseOptions()
-	f, err := tea.LogToFile(filepath.Dir(configPath)+"/debug.log", "DEBUG")
+	os.Exit(run())
+}
+
+func run() int {
+	opts, _, err := core.ParseOptions()
 	if err != nil {
-		log.Fatalf("log to file err : %s", err)
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	f, err := core.SetupLogging(&opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
 	// go func() {
 	// 	http.ListenAndServe("localhost:10080", nil)
@@ -22,5 +30,9 @@ func main() {
 	defer func() {
 		_ = f.Close()
 	}()
-	core.Start(&opts)
+	if err := core.Start(&opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
 }
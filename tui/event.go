@@ -45,6 +45,10 @@ var MoveEvent = &Event{
 var ClearInputEvent = &Event{
 	Keys: []string{"ctrl+x"},
 	Cb: func(_ string, m *Model) (tea.Model, tea.Cmd) {
+		if m.Form != nil {
+			m.Form.Clear()
+			return m, nil
+		}
 		m.Inputs = []string{}
 		m.InputCursor = 0
 		m.ClearMessage()
@@ -0,0 +1,121 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Field 是表单中的一个字段
+type Field struct {
+	Name     string
+	Value    []string // 按字符拆分的内容
+	Validate func(value string) error
+}
+
+func (f *Field) String() string {
+	return strings.Join(f.Value, "")
+}
+
+func (f *Field) Err() error {
+	if f.Validate == nil {
+		return nil
+	}
+	return f.Validate(f.String())
+}
+
+// Form 是逐个字段修改的表单，Tab与Shift+Tab在字段间切换
+type Form struct {
+	Fields []*Field
+	Index  int // 当前字段
+	Cursor int // 当前字段中光标的位置
+}
+
+func NewForm(fields ...*Field) *Form {
+	f := &Form{Fields: fields}
+	f.focus(0)
+	return f
+}
+
+func NewField(name, value string, validate func(value string) error) *Field {
+	return &Field{Name: name, Value: strings.Split(value, ""), Validate: validate}
+}
+
+func (f *Form) Curr() *Field {
+	return f.Fields[f.Index]
+}
+
+// Validate 返回第一个未通过检查的字段的错误，并切换到该字段
+func (f *Form) Validate() error {
+	for i, field := range f.Fields {
+		if err := field.Err(); err != nil {
+			f.focus(i)
+			return fmt.Errorf("%s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func (f *Form) focus(index int) {
+	if len(f.Fields) == 0 {
+		return
+	}
+	f.Index = (index + len(f.Fields)) % len(f.Fields)
+	f.Cursor = len(f.Curr().Value)
+}
+
+// Clear 清空当前字段
+func (f *Form) Clear() {
+	f.Curr().Value = []string{}
+	f.Cursor = 0
+}
+
+func (f *Form) inputCtl(key string) {
+	field := f.Curr()
+	switch strings.ToLower(key) {
+	case "tab":
+		f.focus(f.Index + 1)
+	case "shift+tab":
+		f.focus(f.Index - 1)
+	case "backspace":
+		if f.Cursor > 0 {
+			field.Value = slices.Delete(field.Value, f.Cursor-1, f.Cursor)
+			f.Cursor--
+		}
+	case "left":
+		if f.Cursor > 0 {
+			f.Cursor--
+		}
+	case "right":
+		if f.Cursor < len(field.Value) {
+			f.Cursor++
+		}
+	default:
+		if strings.Contains(key, "shift+") || strings.Contains(key, "ctrl+") || strings.Contains(key, "alt+") {
+			return
+		}
+		split := strings.Split(key, "")
+		field.Value = slices.Insert(field.Value, f.Cursor, split...)
+		f.Cursor += len(split)
+	}
+}
+
+func (f *Form) View() string {
+	inputCursor := "\x1b[5;1;31m|\x1b[0m"
+	var sb strings.Builder
+	for i, field := range f.Fields {
+		if i > 0 {
+			sb.WriteString("  ")
+		}
+		if i == f.Index {
+			fmt.Fprintf(&sb, "\x1b[35m%s\x1b[0m:[%s%s%s]", field.Name,
+				strings.Join(field.Value[:f.Cursor], ""), inputCursor, strings.Join(field.Value[f.Cursor:], ""))
+		} else {
+			fmt.Fprintf(&sb, "%s:[%s]", field.Name, field.String())
+		}
+	}
+	if err := f.Curr().Err(); err != nil {
+		fmt.Fprintf(&sb, "  \x1b[31m%v\x1b[0m", err)
+	}
+	return sb.String()
+}
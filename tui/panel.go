@@ -0,0 +1,75 @@
+package tui
+
+import "errors"
+
+// Panel 是显示在列表区域的面板(如候选预览、权重工具)，持有自己的项、选择的位置与菜单。
+// 通过 ListManager.AddPanel 注册，显示时 ListManager 的 List、StepIndex 等作用于此面板
+type Panel struct {
+	Menus   []*Menu // 显示此面板时的菜单
+	items   []ItemRender
+	index   int
+	mode    ListMode
+	selects bool
+}
+
+// Set 设置面板的项，index为选择的位置
+func (p *Panel) Set(items []ItemRender, index int) {
+	p.items = items
+	p.SetIndex(index)
+}
+
+func (p *Panel) Items() []ItemRender {
+	return p.items
+}
+
+func (p *Panel) Index() int {
+	return p.index
+}
+
+func (p *Panel) SetIndex(index int) {
+	p.index = max(0, min(index, len(p.items)-1))
+}
+
+// SelectsItem 使面板显示时 ListManager.Curr 返回此面板中选择的项(如候选预览中的项)，而不是搜索结果中的项
+func (p *Panel) SelectsItem() *Panel {
+	p.selects = true
+	return p
+}
+
+func (p *Panel) curr() (ItemRender, error) {
+	if p.index >= len(p.items) {
+		return nil, errors.New("index out of panel")
+	}
+	return p.items[p.index], nil
+}
+
+// AddPanel 注册一个新的面板
+func (l *ListManager) AddPanel() *Panel {
+	p := &Panel{mode: LIST_MODE_PANEL + ListMode(len(l.panels))}
+	l.panels = append(l.panels, p)
+	return p
+}
+
+// ShowPanel 在列表区域显示p
+func (l *ListManager) ShowPanel(p *Panel) {
+	l.ListMode = p.mode
+}
+
+// Showing 是否正在显示p
+func (l *ListManager) Showing(p *Panel) bool {
+	return l.ListMode == p.mode
+}
+
+// Panel 返回正在显示的面板，显示的不是面板时返回nil
+func (l *ListManager) Panel() *Panel {
+	if i := int(l.ListMode) - int(LIST_MODE_PANEL); i >= 0 && i < len(l.panels) {
+		return l.panels[i]
+	}
+	return nil
+}
+
+// ShowPanel 显示p与其菜单
+func (m *Model) ShowPanel(p *Panel) {
+	m.ListManager.ShowPanel(p)
+	m.ShowMenus()
+}
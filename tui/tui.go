@@ -26,6 +26,9 @@ type FreshListMsg int
 
 type NotifitionMsg string
 
+// ReloadedMsg 通知码表文件已重新读取，列表与编辑表单中的项已被替换，需关闭表单并重新搜索
+type ReloadedMsg string
+
 type ItemRender interface {
 	Id() int
 	String() string
@@ -55,10 +58,11 @@ type Menu struct {
 type ListMode uint8
 
 var (
-	LIST_MODE_DICT ListMode = 1
-	LIST_MODE_FILE ListMode = 2
-	LIST_MODE_HELP ListMode = 3
-	LIST_MODE_EXPO ListMode = 4
+	LIST_MODE_DICT  ListMode = 1
+	LIST_MODE_FILE  ListMode = 2
+	LIST_MODE_HELP  ListMode = 3
+	LIST_MODE_EXPO  ListMode = 4
+	LIST_MODE_PANEL ListMode = 5 // 通过 ListManager.AddPanel 注册的面板依次从此开始
 )
 
 type ListManager struct {
@@ -73,6 +77,7 @@ type ListManager struct {
 	ExportOptions      []ItemRender
 	ExportOptionsIndex int
 	helpIndex          int
+	panels             []*Panel
 }
 
 func (l *ListManager) ReSort() {
@@ -88,6 +93,10 @@ func NewListManager(searchChan chan<- string) *ListManager {
 }
 
 func (l *ListManager) StepIndex(mod int) {
+	if p := l.Panel(); p != nil {
+		p.SetIndex(p.index + mod)
+		return
+	}
 	var getIndex func() *int
 	var getLen func() int
 	switch l.ListMode {
@@ -131,6 +140,9 @@ func (l *ListManager) StepIndex(mod int) {
 }
 
 func (l *ListManager) List() ([]ItemRender, int) {
+	if p := l.Panel(); p != nil {
+		return p.items, p.index
+	}
 	switch l.ListMode {
 	case LIST_MODE_DICT:
 		le := len(l.list)
@@ -167,17 +179,28 @@ func (l *ListManager) Helps() []ItemRender {
 		StringRender("Ctrl+S:     手动同步，如果没有启用自动同步，"),
 		StringRender("            可通过此按键手动将变更同步至文件，并部署Rime"),
 		StringRender("Ctrl+O:     导出码表到当前目录下的output.txt文件中"),
+		StringRender("            或导出本次写入码表的变更记录(changelog.txt，可通过 rimedm apply 应用)"),
+		StringRender("            或格式化当前项所在的文件(按编码或字词排序，规范分隔符，删除重复项)"),
 		StringRender("Ctrl+Right: 修改权重，将当前项的权重加一"),
 		StringRender("Ctrl+Left:  修改权重，将当前项的权重减一"),
 		StringRender("Ctrl+Down:  修改权重，将当前项的权重增加到下一项之前"),
 		StringRender("Ctrl+Up:    修改权重，将当前项的权重降低到上一项之后"),
+		StringRender("            不带权重的码表中，将当前项的行移动到编码相同的相邻项之前或之后"),
+		StringRender("Ctrl+P:     预览当前项的编码在Rime中的候选顺序(所有词典中编码相同的项)，"),
+		StringRender("            高亮项为当前项的位置，可配合Ctrl+Up/Down调整"),
+		StringRender("Ctrl+W:     权重工具，对搜索结果或当前项所在的文件批量调整权重"),
+		StringRender("            导入词频表后，未匹配的字词可按造词规则生成编码后添加到文件中"),
+		StringRender("Ctrl+Z:     撤销最近一次的批量调整"),
+		StringRender("Ctrl+T:     显示词典的统计数据(项数、编码长度分布、重码率等)"),
+		StringRender("Ctrl+G:     浏览当前项在git仓库中的变更历史，可还原其中的某次变更(需启用git_history)"),
+		StringRender("Ctrl+R:     切换配置文件中的profile(如不同的方案、前端)，将写入修改后重新加载词典"),
 		StringRender("Enter:      显示菜单"),
 		StringRender("菜单项: [A添加] 将输入的内容(字词 字母码)添加到码表中，"),
 		StringRender("                支持乱序，如(字母码 权重 字词)输入，"),
 		StringRender("                上下方向键选择要添加到的文件"),
 		StringRender("菜单项: [M修改] 修改选择的项(高亮)，"),
-		StringRender("                回车后，输入框中的内容会被设置，"),
-		StringRender("                修改后，再次回车确认修改"),
+		StringRender("                回车后，输入框变为按列分开的表单(字词、编码、权重等)，"),
+		StringRender("                Tab/Shift+Tab切换字段，修改后，再次回车确认修改"),
 		StringRender("菜单项: [D删除] 将选择的项(高亮)从码表中删除，通过上下键选择"),
 	}
 	slices.Reverse(list)
@@ -185,6 +208,9 @@ func (l *ListManager) Helps() []ItemRender {
 }
 
 func (l *ListManager) Curr() (ItemRender, error) {
+	if p := l.Panel(); p != nil && p.selects {
+		return p.curr()
+	}
 	if len(l.list) == 0 {
 		return nil, errors.New("empty list")
 	} else if l.currIndex >= len(l.list) {
@@ -194,6 +220,11 @@ func (l *ListManager) Curr() (ItemRender, error) {
 	}
 }
 
+// Results 返回当前的搜索结果，不受ListMode影响
+func (l *ListManager) Results() []ItemRender {
+	return l.list
+}
+
 func (l *ListManager) NewList(version int) {
 	l.version = version
 	l.list = make([]ItemRender, 0)
@@ -241,6 +272,7 @@ type Model struct {
 	hx           int
 	InputCursor  int
 	Modifying    bool
+	Form         *Form // 修改中的表单，为nil时修改输入框中的内容
 	message      string
 }
 
@@ -412,6 +444,9 @@ func (m *Model) View() string {
 		for i := top; i >= bot; i-- {
 			l := parseRenderLine(list[i].String(), i, m.wx-20)
 			lines = append(lines, l)
+			if len(l.wids) > len(maxWidth) { // 码表可能有多个其他列
+				maxWidth = append(maxWidth, make([]int, len(l.wids)-len(maxWidth))...)
+			}
 			for i, w := range l.wids {
 				maxWidth[i] = int(math.Max(float64(maxWidth[i]), float64(w)))
 			}
@@ -438,8 +473,12 @@ func (m *Model) View() string {
 	fmt.Fprintf(&sb, "Total: %d; %s\n", le, m.MessageOr(m.CurrItemFile()))
 	sb.WriteString("Press[Enter:操作][Ctrl+X:清空输入][Ctrl+S:同步][ESC:退出][Ctrl+H:帮助]\n")
 	if m.Modifying {
-		sb.WriteString("----修改中  按回车提交修改")
-		line = line[:max(len(line)-26, 1)]
+		hint := "----修改中  按回车提交修改"
+		if m.Form != nil {
+			hint = "----修改中  Tab/Shift+Tab切换字段，按回车提交修改"
+		}
+		sb.WriteString(hint)
+		line = line[:max(len(line)-runewidth.StringWidth(hint), 1)]
 	}
 	sb.WriteString(line + "\n")
 
@@ -453,6 +492,8 @@ func (m *Model) View() string {
 				fmt.Fprintf(&sb, " [\x1b[35m%s\x1b[0m%s] ", string(nameR[0]), string(nameR[1:]))
 			}
 		}
+	} else if m.Form != nil {
+		fmt.Fprintf(&sb, ":%s", m.Form.View())
 	} else {
 		inputCursor := "\x1b[5;1;31m|\x1b[0m"
 		inp := strings.Join(m.Inputs[:m.InputCursor], "") + inputCursor + strings.Join(m.Inputs[m.InputCursor:], "")
@@ -528,6 +569,8 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		if m.MenusShowing {
 			m.menuCtl(key)
+		} else if m.Form != nil {
+			m.Form.inputCtl(key)
 		} else { // search
 			m.inputCtl(key)
 		}
@@ -540,6 +583,12 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case NotifitionMsg:
 		m.message = string(msg)
 		m.FreshList()
+	case ReloadedMsg:
+		m.Modifying, m.Form = false, nil
+		m.ListManager.ListMode = LIST_MODE_DICT
+		m.HideMenus()
+		m.message = string(msg)
+		m.FreshList()
 	case tea.WindowSizeMsg:
 		m.wx = msg.Width
 		m.hx = msg.Height
@@ -551,13 +600,12 @@ func (m *Model) AddEvent(events ...*Event) {
 	m.eventManager.Add(events...)
 }
 
-func NewModel(listManager *ListManager, menuFetcher func(m *Model) []*Menu) *Model {
+func NewModel(listManager *ListManager, menuFetcher func(m *Model) []*Menu) (*Model, error) {
 	fd := os.Stderr.Fd()
 	wx, hx, err := term.GetSize(int(fd))
 	if err != nil {
-		fmt.Printf("Terminal GetSize Error: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("获取终端大小失败: %w", err)
 	}
 	model := &Model{ListManager: listManager, wx: wx, hx: hx, menuFetcher: menuFetcher, eventManager: NewEventManager(), message: ""}
-	return model
+	return model, nil
 }
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"sync"
+)
+
+// Coalescer 是单写者的执行队列：同一时间只有一个请求的fn在执行，
+// 执行期间到达的请求会合并为一次，在当前执行结束后再执行，保证每个请求之后都有一次完整的执行。
+// 合并时只执行其中一个请求的fn，因此各请求的fn应当是等价的(如：将所有变更写入文件)
+type Coalescer struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	running   bool
+	waiting   int    // 等待执行的请求数
+	requested uint64 // 最新请求的序号
+	done      uint64 // 已完成的执行所覆盖的最大请求序号
+}
+
+func NewCoalescer() *Coalescer {
+	c := &Coalescer{}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Do 请求一次执行，并阻塞到覆盖此请求的执行完成。
+// 若没有正在进行的执行，则在当前goroutine中执行fn；否则等待，之后由其中一个等待者合并执行
+func (c *Coalescer) Do(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requested++
+	c.await(c.requested, fn)
+}
+
+// Trigger 请求一次执行，不阻塞
+func (c *Coalescer) Trigger(fn func()) {
+	c.mu.Lock()
+	c.requested++
+	seq := c.requested
+	c.waiting++ // 在返回前计数，使之后的Wait能等到此请求
+	c.mu.Unlock()
+	go func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.waiting--
+		c.await(seq, fn)
+	}()
+}
+
+// Wait 等待正在进行与已请求的执行全部完成
+func (c *Coalescer) Wait() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.running || c.waiting > 0 {
+		c.cond.Wait()
+	}
+}
+
+// 需持有锁
+func (c *Coalescer) await(seq uint64, fn func()) {
+	c.waiting++
+	defer func() {
+		c.waiting--
+		c.cond.Broadcast() // 唤醒Wait
+	}()
+	for c.done < seq {
+		if c.running {
+			c.cond.Wait()
+			continue
+		}
+		c.running = true
+		c.run(c.requested, fn)
+	}
+}
+
+// 需持有锁，执行fn期间释放锁
+func (c *Coalescer) run(target uint64, fn func()) {
+	ok := false
+	c.mu.Unlock()
+	defer func() { // fn panic时也要释放，避免等待者永远阻塞
+		c.mu.Lock()
+		if ok {
+			c.done = max(c.done, target)
+		}
+		c.running = false
+		c.cond.Broadcast()
+	}()
+	fn()
+	ok = true
+}
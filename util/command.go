@@ -3,6 +3,7 @@
 package util
 
 import (
+	"context"
 	"os"
 	"os/exec"
 )
@@ -15,3 +16,12 @@ func Run(command string) *exec.Cmd {
 	cmd := exec.Command(shell, "-c", command)
 	return cmd
 }
+
+// RunContext 与 Run 相同，但在ctx结束时终止命令
+func RunContext(ctx context.Context, command string) *exec.Cmd {
+	shell := os.Getenv("SHELL")
+	if len(shell) == 0 {
+		shell = "sh"
+	}
+	return exec.CommandContext(ctx, shell, "-c", command)
+}
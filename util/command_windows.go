@@ -3,6 +3,7 @@
 package util
 
 import (
+	"context"
 	"os"
 	"os/exec"
 )
@@ -14,3 +15,12 @@ func Run(command string) *exec.Cmd {
 	}
 	return exec.Command(shell, "/C", command)
 }
+
+// RunContext 与 Run 相同，但在ctx结束时终止命令
+func RunContext(ctx context.Context, command string) *exec.Cmd {
+	shell := os.Getenv("SHELL")
+	if len(shell) == 0 {
+		shell = "cmd"
+	}
+	return exec.CommandContext(ctx, shell, "/C", command)
+}